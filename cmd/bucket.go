@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/bucket"
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+// mbCmd creates a bucket
+var mbCmd = &cobra.Command{
+	Use:   "mb <[s3://]bucket>",
+	Short: "Create a bucket",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		cobra.CheckErr(bucket.MakeBucket(cfg, bucketArg(args[0])))
+	},
+}
+
+// rbCmd deletes a bucket
+var rbCmd = &cobra.Command{
+	Use:   "rb <[s3://]bucket>",
+	Short: "Delete a bucket, with --force emptying it first",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		cobra.CheckErr(bucket.RemoveBucket(cfg, bucketArg(args[0])))
+	},
+}
+
+// bucketCmd groups the commands about a bucket
+var bucketCmd = &cobra.Command{
+	Use:   "bucket",
+	Short: "Inspect buckets",
+}
+
+// bucketInfoCmd prints the configuration of a bucket
+var bucketInfoCmd = &cobra.Command{
+	Use:   "info <[s3://]bucket>",
+	Short: "Print versioning, encryption, lifecycle, policy, CORS, tagging and object lock of a bucket",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		cobra.CheckErr(bucket.PrintInfo(cfg, bucketArg(args[0])))
+	},
+}
+
+// bucketArg accepts a bucket name with or without the s3:// scheme.
+func bucketArg(arg string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(arg, "s3://"), "/")
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/chaos"
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+// chaosProxyCmd injects faults between a client and an S3 endpoint
+var chaosProxyCmd = &cobra.Command{
+	Use:   "chaos-proxy",
+	Short: "Forward to the S3 endpoint, injecting faults into the requests the rules match",
+	Long: `Listen on --listen and forward to the --s3-host endpoint, with its
+--address, --ca-file and --server-name, injecting faults into the requests
+the rules match. The Host header the client signed is kept, so point the
+client's --address at the proxy to sign for the endpoint's own host.
+
+A rule is space-separated name=value fields; the first rule that fires
+faults the request:
+
+  op=PutObject|UploadPart   operations, globs separated by |
+  bucket=logs-*             buckets, globs separated by |
+  key=*.bin|data/*          keys, globs on the full key or base name
+  p=0.1                     probability, 1 by default
+  after=2 times=3           skip 2 matching requests, then fault 3
+  latency=2s                delay before forwarding
+  status=503 code=SlowDown  an S3 error instead of forwarding
+  body=request              the body of the faults below, response by default
+  bandwidth=256KiB          bytes per second of the body
+  reset=1MiB                reset the connection after so many body bytes
+  truncate=1MiB             close the connection after so many body bytes
+  corrupt=1000              flip the byte at this offset of the body
+
+For example:
+
+  awsfiles chaos-proxy -u https://s3.example.com \
+    --rule 'op=UploadPart times=2 status=503' \
+    --rule 'op=GetObject key=*.bin reset=5MiB p=0.5'`,
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		cobra.CheckErr(chaos.Run(cfg))
+	},
+}
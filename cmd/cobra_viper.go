@@ -9,10 +9,17 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
+	"github.com/vskurikhin/awsfiles/internal/config"
 	"github.com/vskurikhin/awsfiles/pkg/tool"
 )
 
 func mergeCobraAndViper(cmd *cobra.Command) {
+	for _, key := range config.Keys() {
+		viperBindEnv(tool.SnakeCaseToKebabCase(key), cmd)
+	}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		viperBindEnv(f.Name, cmd)
+	})
 	for key, _ := range viper.GetViper().AllSettings() {
 		viperBindPFlag(key, tool.SnakeCaseToKebabCase(key), cmd)
 	}
@@ -40,13 +47,27 @@ func mergeCobraAndViperFunc(cmd *cobra.Command) func(f *pflag.Flag) {
 					value, _ = strconv.Atoi(f.DefValue)
 					viper.Set(tool.KebabCaseToSnakeCase(f.Name), value)
 				}
-			case "string":
+			case "duration", "string":
 				viper.Set(tool.KebabCaseToSnakeCase(f.Name), f.Value.String())
+			case "int64", tool.ByteSizeType:
+				value, _ := strconv.ParseInt(f.Value.String(), 10, 64)
+				viper.Set(tool.KebabCaseToSnakeCase(f.Name), value)
+			case "stringSlice":
+				if sv, ok := f.Value.(pflag.SliceValue); ok {
+					viper.Set(tool.KebabCaseToSnakeCase(f.Name), sv.GetSlice())
+				}
 			}
 		}
 	}
 }
 
+func viperBindEnv(flag string, cmd *cobra.Command) {
+	err := config.BindEnv(flag)
+	if err != nil && tool.IsDebug(cmd) {
+		slog.Error("Error binding env", "error", err)
+	}
+}
+
 func viperBindPFlag(key, flag string, cmd *cobra.Command) {
 	err := viper.BindPFlag(key, cmd.Flags().Lookup(flag))
 	if err != nil && tool.IsDebug(cmd) {
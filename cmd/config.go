@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+// configCmd groups the commands that inspect and manage settings
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and manage awsfiles settings",
+}
+
+// configEnvCmd lists the environment variables of every setting
+var configEnvCmd = &cobra.Command{
+	Use:   "env",
+	Short: "List the environment variables of every setting",
+	Run: func(cmd *cobra.Command, args []string) {
+		printEnv(os.Stdout)
+	},
+}
+
+// configInitCmd interactively writes a config file
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Interactively write a .awsfiles.yaml config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		cfg := config.MakeConfig(cmd)
+		path := configFilePath()
+		force, _ := cmd.Flags().GetBool(FlagForce)
+		err := config.WriteInteractive(os.Stdin, os.Stdout, path, cfg, force)
+		cobra.CheckErr(err)
+		fmt.Println("Config written to", path)
+	},
+}
+
+// configShowCmd prints the effective config
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective config with secrets redacted",
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		cfg := config.MakeConfig(cmd)
+		settings := cfg.Redacted()
+		for _, key := range config.Keys() {
+			fmt.Printf("%s: %v\n", key, settings[key])
+		}
+	},
+}
+
+// configValidateCmd checks a config file against the schema
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Check a config file against the schema",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := configFilePath()
+		if len(args) > 0 {
+			path = args[0]
+		} else if viper.ConfigFileUsed() != "" {
+			path = viper.ConfigFileUsed()
+		}
+		if err := config.Validate(path); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: invalid\n%v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: valid\n", path)
+	},
+}
+
+// configExplainCmd reports where the value of a setting comes from
+var configExplainCmd = &cobra.Command{
+	Use:   "explain [command...] <key>",
+	Short: "Report whether a setting comes from a flag, env, file or default",
+	Long: `Report whether a setting comes from a flag, env, file or default. The
+defaults of a flag may differ between commands: name the command, as in
+"config explain multipart cleanup older-than", or get a default per command.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := tool.KebabCaseToSnakeCase(args[len(args)-1])
+		var target *cobra.Command
+		if len(args) > 1 {
+			c, rest, err := rootCmd.Find(args[:len(args)-1])
+			if err != nil || len(rest) > 0 || c == rootCmd {
+				fmt.Fprintf(os.Stderr, "unknown command: %s\n", strings.Join(args[:len(args)-1], " "))
+				os.Exit(1)
+			}
+			target = c
+		}
+		values, ok := explain(cmd, target, tool.SnakeCaseToKebabCase(key))
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown setting: %s\n", args[len(args)-1])
+			os.Exit(1)
+		}
+		for _, v := range values {
+			fmt.Printf("%s = %v (%s)\n", key, config.RedactValue(key, v.value), v.source)
+		}
+	},
+}
+
+// configFilePath returns the config file given by --Config, or the default one.
+func configFilePath() string {
+	if cfgFile != "" {
+		return cfgFile
+	}
+	home, err := os.UserHomeDir()
+	cobra.CheckErr(err)
+	return filepath.Join(home, ".awsfiles.yaml")
+}
+
+// explained is a value of a setting and where it comes from.
+type explained struct {
+	value  any
+	source string
+}
+
+// explain follows the precedence of mergeCobraAndViper: a changed flag,
+// then the environment, then the config file, then the flag default, of
+// the target command or, when nil, each distinct default with the
+// commands that have it.
+func explain(cmd *cobra.Command, target *cobra.Command, name string) ([]explained, bool) {
+	flags := commandFlags(target, name)
+	if len(flags) == 0 {
+		return nil, false
+	}
+	if f := cmd.Flags().Lookup(name); f != nil && f.Changed {
+		return []explained{{f.Value.String(), "flag --" + name}}, true
+	}
+	for _, env := range config.EnvNames(name) {
+		if value, ok := os.LookupEnv(env); ok {
+			return []explained{{value, "env " + env}}, true
+		}
+	}
+	key := tool.KebabCaseToSnakeCase(name)
+	if viper.InConfig(key) {
+		return []explained{{viper.Get(key), "file " + viper.ConfigFileUsed()}}, true
+	}
+	var defaults []string
+	commands := make(map[string][]string)
+	for _, cf := range flags {
+		if _, ok := commands[cf.flag.DefValue]; !ok {
+			defaults = append(defaults, cf.flag.DefValue)
+		}
+		commands[cf.flag.DefValue] = append(commands[cf.flag.DefValue], cf.command)
+	}
+	if len(defaults) == 1 {
+		return []explained{{defaults[0], "default"}}, true
+	}
+	result := make([]explained, 0, len(defaults))
+	for _, def := range defaults {
+		result = append(result, explained{def, "default of " + strings.Join(commands[def], ", ")})
+	}
+	return result, true
+}
+
+// commandFlag is a flag with the path of a command that has it.
+type commandFlag struct {
+	command string
+	flag    *pflag.Flag
+}
+
+// commandFlags returns the flag of the target command, inherited ones
+// included, or when target is nil of every command defining it, in
+// command order.
+func commandFlags(target *cobra.Command, name string) []commandFlag {
+	if target != nil {
+		f := target.Flags().Lookup(name)
+		if f == nil {
+			f = target.InheritedFlags().Lookup(name)
+		}
+		if f == nil {
+			return nil
+		}
+		return []commandFlag{{commandPath(target), f}}
+	}
+	var result []commandFlag
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		f := c.PersistentFlags().Lookup(name)
+		if f == nil {
+			f = c.LocalNonPersistentFlags().Lookup(name)
+		}
+		if f != nil {
+			result = append(result, commandFlag{commandPath(c), f})
+		}
+		for _, sub := range c.Commands() {
+			if sub.Name() != "completion" && sub.Name() != "help" {
+				walk(sub)
+			}
+		}
+	}
+	walk(rootCmd)
+	return result
+}
+
+// commandPath is the path of c below the root command.
+func commandPath(c *cobra.Command) string {
+	if c == rootCmd {
+		return "all commands"
+	}
+	return strings.TrimPrefix(c.CommandPath(), rootCmd.Name()+" ")
+}
+
+// allFlags collects the flags of the whole command tree, sorted by name.
+func allFlags() []*pflag.Flag {
+	seen := make(map[string]*pflag.Flag)
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		visit := func(f *pflag.Flag) {
+			if f.Name != "help" {
+				seen[f.Name] = f
+			}
+		}
+		c.PersistentFlags().VisitAll(visit)
+		c.LocalNonPersistentFlags().VisitAll(visit)
+		for _, sub := range c.Commands() {
+			if sub.Name() != "completion" && sub.Name() != "help" {
+				walk(sub)
+			}
+		}
+	}
+	walk(rootCmd)
+	result := make([]*pflag.Flag, 0, len(seen))
+	for _, f := range seen {
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func printEnv(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "FLAG\tKEY\tVARIABLES")
+	for _, f := range allFlags() {
+		_, _ = fmt.Fprintf(tw, "--%s\t%s\t%s\n",
+			f.Name, tool.KebabCaseToSnakeCase(f.Name), strings.Join(config.EnvNames(f.Name), ", "))
+	}
+	_ = tw.Flush()
+}
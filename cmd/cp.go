@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/transfer"
+)
+
+// cpCmd copies objects between buckets, endpoints and local files
+var cpCmd = &cobra.Command{
+	Use:   "cp <source> <destination>",
+	Short: "Copy s3://bucket/key objects to each other, from or to local files",
+	Long: `Copy s3://bucket/key objects to each other, from or to local files.
+
+Objects on the same endpoint are copied server side, with UploadPartCopy for
+objects over 5 GiB. With --source-profile or --dest-profile naming different
+profiles of the config file the object is streamed through the client.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		srcCfg, dstCfg := cfg, cfg
+		var err error
+		if cfg.SourceProfile != "" {
+			srcCfg, err = config.MakeProfileConfig(cmd, cfg.SourceProfile)
+			cobra.CheckErr(err)
+		}
+		if cfg.DestProfile != "" {
+			dstCfg, err = config.MakeProfileConfig(cmd, cfg.DestProfile)
+			cobra.CheckErr(err)
+		}
+		transfer.Copy(srcCfg, dstCfg, args[0], args[1])
+	},
+}
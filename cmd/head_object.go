@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/object"
+)
+
+// headObjectCmd prints the metadata of an object
+var headObjectCmd = &cobra.Command{
+	Use:     "head-object",
+	Aliases: []string{"stat"},
+	Short:   "Print the metadata of an object, failing if it does not exist",
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		cobra.CheckErr(object.HeadObject(cfg))
+	},
+}
@@ -3,25 +3,88 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/datagen"
+	"github.com/vskurikhin/awsfiles/internal/syncdir"
+	"github.com/vskurikhin/awsfiles/pkg/tool"
 )
 
 const (
 	FlagAccessKeyID        = "access-key-id"
 	FlagAddress            = "address"
+	FlagAddressing         = "addressing"
+	FlagAlgorithm          = "algorithm"
+	FlagAnonymous          = "anonymous"
 	FlagBucket             = "bucket"
 	FlagBufferSize         = "buffer-size"
 	FlagCAFile             = "ca-file"
+	FlagCAOut              = "ca-out"
+	FlagCheckpoint         = "checkpoint"
+	FlagChecksum           = "checksum"
+	FlagCompare            = "compare"
+	FlagConcurrency        = "concurrency"
+	FlagContentType        = "content-type"
+	FlagCount              = "count"
+	FlagDataPattern        = "data-pattern"
 	FlagDebug              = "debug"
+	FlagDelete             = "delete"
+	FlagDestProfile        = "dest-profile"
+	FlagDryRun             = "dry-run"
+	FlagExclude            = "exclude"
+	FlagExpires            = "expires"
+	FlagForce              = "force"
+	FlagFormat             = "format"
+	FlagIfMatch            = "if-match"
+	FlagIfModifiedSince    = "if-modified-since"
+	FlagIfNoneMatch        = "if-none-match"
+	FlagInclude            = "include"
 	FlagInsecureSkipVerify = "insecure-skip-verify"
 	FlagKey                = "key"
+	FlagLeavePartsOnError  = "leave-parts-on-error"
+	FlagListen             = "listen"
+	FlagLocationConstraint = "location-constraint"
+	FlagMaxKeys            = "max-keys"
+	FlagMaxSize            = "max-size"
+	FlagMetadata           = "metadata"
+	FlagMetadataDirective  = "metadata-directive"
+	FlagMinSize            = "min-size"
+	FlagNewerThan          = "newer-than"
+	FlagObjectLock         = "object-lock"
+	FlagOlderThan          = "older-than"
+	FlagOutput             = "output"
+	FlagPartSize           = "part-size"
+	FlagPrefix             = "prefix"
+	FlagProfile            = "profile"
+	FlagRecursive          = "recursive"
+	FlagRegex              = "regex"
+	FlagRegion             = "region"
+	FlagResume             = "resume"
+	FlagRetries            = "retries"
+	FlagRoot               = "root"
+	FlagRule               = "rule"
+	FlagRulesFile          = "rules-file"
 	FlagS3Host             = "s3-host"
 	FlagSecretAccessKey    = "secret-access-key"
+	FlagSeed               = "seed"
 	FlagServerName         = "server-name"
+	FlagSessionToken       = "session-token"
 	FlagSize               = "size"
+	FlagSourceProfile      = "source-profile"
+	FlagSSECustomerKey     = "sse-customer-key"
+	FlagStateFile          = "state-file"
+	FlagStorageClass       = "storage-class"
+	FlagTLS                = "tls"
+	FlagURL                = "url"
 	FlagVerbose            = "verbose"
+	FlagVerify             = "verify"
+	FlagVerifyGenerated    = "verify-generated"
+	FlagWait               = "wait"
 )
 
 func init() {
@@ -35,31 +98,208 @@ func init() {
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
+	rootCmd.PersistentFlags().Bool(FlagAnonymous, false, "Send requests unsigned, without credentials")
 	rootCmd.PersistentFlags().Bool(FlagInsecureSkipVerify, false, "Controls whether a client verifies the server's certificate chain and host name.")
 	rootCmd.PersistentFlags().BoolP(FlagDebug, "d", false, "Help message for debug")
 	rootCmd.PersistentFlags().BoolP(FlagVerbose, "v", false, "Verbose")
+	rootCmd.PersistentFlags().String(FlagProfile, "", "Profile of the config file to use")
 
 	rootCmd.PersistentFlags().Int(FlagBufferSize, 16384, "Buffers size")
 
 	rootCmd.PersistentFlags().String(FlagAddress, "", "Address as host:port")
+	rootCmd.PersistentFlags().String(FlagAddressing, config.AddressingPath, "Bucket addressing style: path, virtual or auto")
 	rootCmd.PersistentFlags().String(FlagCAFile, "", "CA File")
+	rootCmd.PersistentFlags().String(FlagRegion, "", "Region used for SigV4 signing (default us-east-1)")
 	rootCmd.PersistentFlags().String(FlagServerName, "", "TLS servername")
 
 	rootCmd.PersistentFlags().StringP(FlagAccessKeyID, "a", "", "AccessKeyID")
 	rootCmd.PersistentFlags().StringP(FlagS3Host, "u", "", "S3 host URL")
 	rootCmd.PersistentFlags().StringP(FlagSecretAccessKey, "s", "", "SecretAccessKey")
+	rootCmd.PersistentFlags().String(FlagSessionToken, "", "SessionToken")
+
+	chaosProxyCmd.Flags().String(FlagListen, ":9001", "Address to listen on")
+	chaosProxyCmd.Flags().StringSlice(FlagRule, nil, "Fault rule, repeatable, e.g. 'op=GetObject key=*.bin reset=1MiB p=0.5'")
+	chaosProxyCmd.Flags().String(FlagRulesFile, "", "File of rules, one per line, # comments")
+	chaosProxyCmd.Flags().Int64(FlagSeed, 0, "Seed of the rule probabilities (0 picks one)")
+
+	cpCmd.Flags().String(FlagSourceProfile, "", "Profile of the config file for the source endpoint")
+	cpCmd.Flags().String(FlagDestProfile, "", "Profile of the config file for the destination endpoint")
+	cpCmd.Flags().Int(FlagConcurrency, 4, "Number of concurrent UploadPart and UploadPartCopy calls")
+	cpCmd.Flags().Var(tool.NewByteSize(0), FlagPartSize, "Part size of multipart uploads and copies, e.g. 16MiB (0 picks one from the size)")
+	cpCmd.Flags().Bool(FlagLeavePartsOnError, false, "Keep the uploaded parts of a failed multipart upload")
+	cpCmd.Flags().String(FlagMetadataDirective, "", "COPY or REPLACE the metadata of the source")
+	cpCmd.Flags().StringSlice(FlagMetadata, nil, "Metadata as key=value for REPLACE and uploads")
+	cpCmd.Flags().String(FlagContentType, "", "Content-Type for REPLACE and uploads")
+	cpCmd.Flags().String(FlagStorageClass, "", "Storage class of the destination")
+	cpCmd.Flags().StringSlice(FlagChecksum, nil, "Checksums computed in one pass: md5, sha1, sha256, sha512, crc32, crc32c, crc64nvme, the first S3 supports is sent")
+	cpCmd.Flags().Bool(FlagResume, false, "Upload a local file in parts, resuming from the checkpoint file")
+	cpCmd.Flags().String(FlagCheckpoint, "", "Checkpoint file of --resume (default in the temp dir)")
 
 	getObjectCmd.Flags().StringP(FlagBucket, "b", "", "Bucket")
 	getObjectCmd.Flags().StringP(FlagKey, "k", "", "Key")
+	getObjectCmd.Flags().String(FlagIfMatch, "", "Only return the object if its ETag matches")
+	getObjectCmd.Flags().String(FlagIfNoneMatch, "", "Only return the object if its ETag differs")
+	getObjectCmd.Flags().String(FlagIfModifiedSince, "", "Only return the object if modified since this RFC 3339 or HTTP date")
+	getObjectCmd.Flags().String(FlagURL, "", "Presigned URL to download instead of bucket and key")
+	getObjectCmd.Flags().StringSlice(FlagChecksum, nil, "Checksums computed in one pass: md5, sha1, sha256, sha512, crc32, crc32c, crc64nvme, compared with the server's")
+	getObjectCmd.Flags().Var(tool.NewByteSize(0), FlagPartSize, "Part size the object was uploaded with, for the expected ETag (0 guesses it)")
+	getObjectCmd.Flags().Bool(FlagVerifyGenerated, false, "Compare the data with the stream upload-random generated, reporting the first mismatch")
+	getObjectCmd.Flags().StringP(FlagOutput, "o", "", "File to write the object to")
+	getObjectCmd.Flags().Bool(FlagResume, false, "Continue the partial --output file of an earlier run")
+	getObjectCmd.Flags().Int(FlagRetries, 5, "Ranged retries of an interrupted --output download")
+
+	headObjectCmd.Flags().StringP(FlagBucket, "b", "", "Bucket")
+	headObjectCmd.Flags().StringP(FlagKey, "k", "", "Key")
+	headObjectCmd.Flags().String(FlagFormat, config.FormatHuman, "Output format: human or json")
+
+	lsCmd.Flags().BoolP(FlagRecursive, "r", false, "List every key under the prefix instead of stopping at /")
+	lsCmd.Flags().Int(FlagMaxKeys, 0, "Stop after this many entries (0 is unlimited)")
+	lsCmd.Flags().String(FlagFormat, config.FormatHuman, "Output format: human, long or json")
+	addFilterFlags(lsCmd)
+
+	manifestCmd.PersistentFlags().String(FlagAlgorithm, "", "Checksum: md5, sha1, sha256, sha512, crc32, crc32c or crc64nvme (default md5, or the manifest's when verifying)")
+	manifestCmd.PersistentFlags().Int(FlagConcurrency, 4, "Number of objects read in parallel")
+	manifestCreateCmd.Flags().StringP(FlagOutput, "o", "", "File to write the manifest to (default stdout)")
+	manifestCreateCmd.Flags().String(FlagFormat, config.FormatHuman, "Manifest format: human for md5sum's, or json")
+	addFilterFlags(manifestCreateCmd)
+	addFilterFlags(manifestVerifyCmd)
+
+	manifestCmd.AddCommand(manifestCreateCmd)
+	manifestCmd.AddCommand(manifestVerifyCmd)
+
+	mirrorCmd.Flags().String(FlagSourceProfile, "", "Profile of the config file for the source endpoint")
+	mirrorCmd.Flags().String(FlagDestProfile, "", "Profile of the config file for the destination endpoint")
+	mirrorCmd.Flags().String(FlagStateFile, "", "JSON lines file recording mirrored objects, to resume from")
+	mirrorCmd.Flags().Int(FlagConcurrency, 4, "Number of objects mirrored in parallel")
+	addFilterFlags(mirrorCmd)
+
+	mbCmd.Flags().String(FlagLocationConstraint, "", "Location constraint (default is --region)")
+	mbCmd.Flags().Bool(FlagObjectLock, false, "Enable object lock on the new bucket")
+
+	rbCmd.Flags().Bool(FlagForce, false, "Delete all objects, versions and multipart uploads first")
+
+	multipartCmd.PersistentFlags().StringP(FlagBucket, "b", "", "Bucket")
+	multipartCmd.PersistentFlags().String(FlagFormat, config.FormatHuman, "Output format: human or json")
+	multipartAbortCmd.Flags().StringP(FlagKey, "k", "", "Key (looked up when not given)")
+	multipartPartsCmd.Flags().StringP(FlagKey, "k", "", "Key (looked up when not given)")
+	multipartLsCmd.Flags().String(FlagPrefix, "", "Only uploads of keys with this prefix")
+	multipartCleanupCmd.Flags().String(FlagPrefix, "", "Only uploads of keys with this prefix")
+	multipartCleanupCmd.Flags().Duration(FlagOlderThan, 24*time.Hour, "Only uploads initiated longer ago than this")
+	multipartCleanupCmd.Flags().Bool(FlagDryRun, false, "Only print what would be aborted")
+
+	multipartCmd.AddCommand(multipartAbortCmd)
+	multipartCmd.AddCommand(multipartCleanupCmd)
+	multipartCmd.AddCommand(multipartLsCmd)
+	multipartCmd.AddCommand(multipartPartsCmd)
+
+	presignCmd.PersistentFlags().StringP(FlagBucket, "b", "", "Bucket")
+	presignCmd.PersistentFlags().StringP(FlagKey, "k", "", "Key")
+	presignCmd.PersistentFlags().Duration(FlagExpires, 15*time.Minute, "How long the URL stays valid")
+	presignCmd.PersistentFlags().String(FlagContentType, "", "Content-Type signed into a PUT URL")
+	presignCmd.PersistentFlags().String(FlagSSECustomerKey, "", "SSE-C key, raw or base64, signed into the URL")
+	presignCmd.PersistentFlags().Bool(FlagVerify, false, "Exercise the URL right away through the custom transport")
+
+	presignCmd.AddCommand(presignDeleteCmd)
+	presignCmd.AddCommand(presignGetCmd)
+	presignCmd.AddCommand(presignHeadCmd)
+	presignCmd.AddCommand(presignPutCmd)
 
-	uploadRandomCmd.Flags().Int(FlagSize, 65536, "Size to upload")
+	rmCmd.Flags().StringP(FlagBucket, "b", "", "Bucket")
+	rmCmd.Flags().StringP(FlagKey, "k", "", "Key, or the prefix with --recursive")
+	rmCmd.Flags().BoolP(FlagRecursive, "r", false, "Delete every object under the prefix")
+	rmCmd.Flags().Bool(FlagDryRun, false, "Only print what would be deleted")
+	rmCmd.Flags().Int(FlagConcurrency, 4, "Number of concurrent DeleteObjects calls")
+	addFilterFlags(rmCmd)
 
+	roundtripCmd.Flags().StringP(FlagBucket, "b", "", "Bucket")
+	roundtripCmd.Flags().StringP(FlagKey, "k", "", "Key (default awsfiles-roundtrip-<time>)")
+	roundtripCmd.Flags().String(FlagSize, "1MiB", "Size to upload, e.g. 64MiB, or a distribution as for upload-random")
+	roundtripCmd.Flags().String(FlagDataPattern, datagen.Random, "Data as for upload-random")
+	roundtripCmd.Flags().StringSlice(FlagChecksum, nil, "Checksums compared besides MD5: md5, sha1, sha256, sha512, crc32, crc32c, crc64nvme, the first S3 supports is sent")
+	roundtripCmd.Flags().Int64(FlagSeed, 0, "Seed of the data (0 picks one)")
+	addPartFlags(roundtripCmd)
+	roundtripCmd.Flags().Duration(FlagWait, time.Minute, "How long to wait for the object to exist")
+	roundtripCmd.Flags().Bool(FlagDelete, false, "Delete the object at the end")
+	roundtripCmd.Flags().String(FlagFormat, config.FormatHuman, "Output format: human or json")
+
+	serveCmd.Flags().String(FlagRoot, "", "Directory of the buckets (default memory)")
+	serveCmd.Flags().String(FlagListen, ":9000", "Address to listen on")
+	serveCmd.Flags().Bool(FlagTLS, false, "Serve HTTPS with a certificate of a generated CA")
+	serveCmd.Flags().String(FlagCAOut, "", "File to write the CA certificate to (default <root>/.awsfiles/ca.pem or in the temp dir)")
+
+	syncCmd.Flags().String(FlagCompare, syncdir.CompareMtime, "Compare by mtime (size and mtime) or checksum (MD5 or multipart ETag)")
+	syncCmd.Flags().Bool(FlagDelete, false, "Delete destination files that are not in the source")
+	syncCmd.Flags().Bool(FlagDryRun, false, "Only print what would be transferred and deleted")
+	syncCmd.Flags().Int(FlagConcurrency, 4, "Number of parallel transfers")
+	syncCmd.Flags().Var(tool.NewByteSize(0), FlagPartSize, "Part size of multipart uploads and checksum comparison, e.g. 16MiB (0 picks one from the size)")
+	syncCmd.Flags().String(FlagContentType, "", "Content-Type of uploaded files")
+	syncCmd.Flags().String(FlagStorageClass, "", "Storage class of uploaded files")
+	addFilterFlags(syncCmd)
+
+	uploadRandomCmd.Flags().String(FlagSize, "64KiB", "Size to upload, e.g. 10GB or 1.5TiB, or a distribution: uniform:1KiB-10MiB, lognormal:<mean>,<stddev> or histogram:<file>")
+	uploadRandomCmd.Flags().String(FlagDataPattern, datagen.Random, "Data: random, zeros, compressible:<ratio>, dedupable:<block>,<unique-fraction>, file:<path> or math-rand")
+	uploadRandomCmd.Flags().StringSlice(FlagChecksum, nil, "Checksums computed in one pass: md5, sha1, sha256, sha512, crc32, crc32c, crc64nvme, the first S3 supports is sent")
+	uploadRandomCmd.Flags().Int64(FlagSeed, 0, "Seed of the data and sizes, object n of --count gets seed+n-1 (0 picks one)")
+	uploadRandomCmd.Flags().Int(FlagCount, 1, "Number of objects to upload, keys suffixed -1, -2...")
+	addPartFlags(uploadRandomCmd)
+	uploadRandomCmd.Flags().Bool(FlagResume, false, "Upload in parts, resuming from the checkpoint file")
+	uploadRandomCmd.Flags().String(FlagCheckpoint, "", "Checkpoint file of --resume (default in the temp dir)")
+
+	bucketInfoCmd.Flags().String(FlagFormat, config.FormatHuman, "Output format: human or json")
+
+	bucketCmd.AddCommand(bucketInfoCmd)
+
+	configInitCmd.Flags().Bool(FlagForce, false, "Overwrite an existing config file")
+
+	configCmd.AddCommand(configEnvCmd)
+	configCmd.AddCommand(configExplainCmd)
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+
+	rootCmd.AddCommand(bucketCmd)
+	rootCmd.AddCommand(chaosProxyCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(cpCmd)
 	rootCmd.AddCommand(getObjectCmd)
+	rootCmd.AddCommand(headObjectCmd)
+	rootCmd.AddCommand(lsCmd)
+	rootCmd.AddCommand(manifestCmd)
+	rootCmd.AddCommand(mbCmd)
+	rootCmd.AddCommand(mirrorCmd)
+	rootCmd.AddCommand(multipartCmd)
+	rootCmd.AddCommand(presignCmd)
+	rootCmd.AddCommand(rbCmd)
+	rootCmd.AddCommand(rmCmd)
+	rootCmd.AddCommand(roundtripCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(syncCmd)
 	rootCmd.AddCommand(uploadRandomCmd)
 }
 
+// addPartFlags adds the flags tuning multipart uploads.
+func addPartFlags(cmd *cobra.Command) {
+	cmd.Flags().Var(tool.NewByteSize(0), FlagPartSize, "Part size of multipart uploads, e.g. 16MiB (0 picks one from the size)")
+	cmd.Flags().Int(FlagConcurrency, 5, "Number of concurrent UploadPart calls")
+	cmd.Flags().Bool(FlagLeavePartsOnError, false, "Keep the uploaded parts of a failed multipart upload")
+}
+
+// addFilterFlags adds the key, size and time filters of listing.Filter.
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice(FlagInclude, nil, "Only keys matching these globs (full key or base name)")
+	cmd.Flags().StringSlice(FlagExclude, nil, "Skip keys matching these globs (full key or base name)")
+	cmd.Flags().String(FlagRegex, "", "Only keys matching this regular expression")
+	cmd.Flags().Var(tool.NewByteSize(0), FlagMinSize, "Only objects of at least this size, e.g. 1MiB")
+	cmd.Flags().Var(tool.NewByteSize(0), FlagMaxSize, "Only objects of at most this size (0 is unlimited)")
+	cmd.Flags().Duration(FlagNewerThan, 0, "Only objects modified within this duration")
+	cmd.Flags().Duration(FlagOlderThan, 0, "Only objects modified longer ago than this duration")
+}
+
 // initConfig reads in Config file and ENV variables if set.
 func initConfig() {
+	if cfgFile == "" {
+		cfgFile = os.Getenv(tool.KebabCaseToEnvVar(config.EnvPrefix, "Config"))
+	}
 	if cfgFile != "" {
 		// Use Config file from the flag.
 		viper.SetConfigFile(cfgFile)
@@ -73,6 +313,8 @@ func initConfig() {
 		viper.SetConfigType("yaml")
 		viper.SetConfigName(".awsfiles")
 	}
+	viper.SetEnvPrefix(config.EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a Config file is found, read it in.
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/listing"
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+// lsCmd lists the objects under a prefix, or the buckets
+var lsCmd = &cobra.Command{
+	Use:   "ls [s3://bucket/prefix]",
+	Short: "List objects under a bucket prefix, or the buckets",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		// Only the argument names a bucket, a bucket of the environment or
+		// config file would hide the bucket list.
+		var bucket, prefix string
+		if len(args) > 0 {
+			var ok bool
+			if bucket, prefix, ok = tool.ParseS3URI(args[0]); !ok {
+				cobra.CheckErr("expected s3://bucket/prefix, got " + args[0])
+			}
+		}
+		listing.List(cfg, bucket, prefix)
+	},
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/manifest"
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+// manifestCmd groups the checksum manifest commands
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Write and verify checksum manifests of the objects under a prefix",
+}
+
+// manifestCreateCmd writes the checksum manifest of a prefix
+var manifestCreateCmd = &cobra.Command{
+	Use:   "create s3://bucket/prefix",
+	Short: "Read every object under a prefix and write an md5sum compatible or JSON manifest",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		bucket, prefix, ok := tool.ParseS3URI(args[0])
+		if !ok {
+			cobra.CheckErr("expected s3://bucket/prefix, got " + args[0])
+		}
+		cobra.CheckErr(manifest.Create(cfg, bucket, prefix))
+	},
+}
+
+// manifestVerifyCmd checks the objects of a prefix against a manifest
+var manifestVerifyCmd = &cobra.Command{
+	Use:   "verify <manifest> [s3://bucket/prefix]",
+	Short: "Re-read the objects and report those missing, changed or not in the manifest",
+	Long: `Re-read the objects and report those missing, changed or not in the
+manifest. The prefix defaults to the one a JSON manifest records, an md5sum
+manifest needs it. The exit status is non-zero unless every object matches.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		var bucket, prefix string
+		if len(args) > 1 {
+			var ok bool
+			if bucket, prefix, ok = tool.ParseS3URI(args[1]); !ok {
+				cobra.CheckErr("expected s3://bucket/prefix, got " + args[1])
+			}
+		}
+		cobra.CheckErr(manifest.Verify(cfg, args[0], bucket, prefix))
+	},
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/mirror"
+)
+
+// mirrorCmd copies a bucket prefix between two independently configured endpoints
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror <s3://source-bucket/prefix> <s3://dest-bucket/prefix>",
+	Short: "Mirror a bucket prefix between two independently configured endpoints",
+	Long: `Mirror a bucket prefix between two independently configured endpoints.
+
+Each side uses the endpoint, CA file, SNI name and keys of its profile from
+the config file. Objects are streamed, keep their metadata and tags, and are
+verified by MD5 on both sides. With --state-file an interrupted mirror
+continues where it stopped.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		srcCfg, err := config.MakeProfileConfig(cmd, cfg.SourceProfile)
+		cobra.CheckErr(err)
+		dstCfg, err := config.MakeProfileConfig(cmd, cfg.DestProfile)
+		cobra.CheckErr(err)
+		mirror.Mirror(srcCfg, dstCfg, args[0], args[1])
+	},
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/multipart"
+)
+
+// multipartCmd groups the commands administering multipart uploads
+var multipartCmd = &cobra.Command{
+	Use:   "multipart",
+	Short: "Administer incomplete multipart uploads",
+}
+
+// multipartLsCmd lists the incomplete multipart uploads
+var multipartLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List incomplete multipart uploads",
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		cobra.CheckErr(multipart.List(cfg, cfg.Bucket, cfg.Prefix))
+	},
+}
+
+// multipartPartsCmd lists the parts of a multipart upload
+var multipartPartsCmd = &cobra.Command{
+	Use:   "parts <upload-id>",
+	Short: "List the uploaded parts of a multipart upload",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		cobra.CheckErr(multipart.ListParts(cfg, cfg.Bucket, cfg.Key, args[0]))
+	},
+}
+
+// multipartAbortCmd aborts a multipart upload
+var multipartAbortCmd = &cobra.Command{
+	Use:   "abort <upload-id>",
+	Short: "Abort a multipart upload",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		cobra.CheckErr(multipart.Abort(cfg, cfg.Bucket, cfg.Key, args[0]))
+	},
+}
+
+// multipartCleanupCmd aborts stale multipart uploads
+var multipartCleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Abort multipart uploads initiated longer ago than --older-than",
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		cobra.CheckErr(multipart.Cleanup(cfg, cfg.Bucket, cfg.Prefix))
+	},
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/presign"
+)
+
+// presignCmd groups the commands that generate presigned URLs
+var presignCmd = &cobra.Command{
+	Use:   "presign",
+	Short: "Generate presigned URLs for an object",
+}
+
+var presignGetCmd = newPresignCmd("get", http.MethodGet)
+
+var presignPutCmd = newPresignCmd("put", http.MethodPut)
+
+var presignHeadCmd = newPresignCmd("head", http.MethodHead)
+
+var presignDeleteCmd = newPresignCmd("delete", http.MethodDelete)
+
+func newPresignCmd(use, method string) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: "Generate a presigned " + method + " URL",
+		Run: func(cmd *cobra.Command, args []string) {
+			setSlogDebug(cmd)
+			mergeCobraAndViper(cmd)
+			slogInfoVerbose(cmd)
+			cfg := config.MakeConfig(cmd)
+			presign.Presign(cfg, method)
+		},
+	}
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/remove"
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+// rmCmd deletes an object, or every object under a prefix
+var rmCmd = &cobra.Command{
+	Use:   "rm [s3://bucket/key]",
+	Short: "Delete an object, or with --recursive every object under a prefix",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		bucket, key := cfg.Bucket, cfg.Key
+		if len(args) > 0 {
+			var ok bool
+			if bucket, key, ok = tool.ParseS3URI(args[0]); !ok {
+				cobra.CheckErr("expected s3://bucket/key, got " + args[0])
+			}
+		}
+		if key == "" && !cfg.Recursive {
+			cobra.CheckErr("a key is required without --recursive")
+		}
+		remove.Remove(cfg, bucket, key)
+	},
+}
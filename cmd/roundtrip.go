@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/roundtrip"
+)
+
+// roundtripCmd smoke-tests an endpoint with an upload read back
+var roundtripCmd = &cobra.Command{
+	Use:   "roundtrip",
+	Short: "Upload generated data, read it back and compare, timing each step",
+	Long: `Upload generated data, wait for the object, check its size and ETag
+with HEAD, read it back comparing the checksums and optionally delete it.
+Prints the timing of each step and PASS or FAIL, the exit status is
+non-zero on FAIL.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		cobra.CheckErr(roundtrip.Roundtrip(cfg))
+	},
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/server"
+)
+
+// serveCmd runs a local S3-compatible server
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a minimal S3-compatible server over a directory or memory, for testing",
+	Long: `Run a minimal S3-compatible server over a directory or, without --root,
+memory: SigV4 verified with --access-key-id and --secret-access-key, buckets,
+objects, listings, multipart uploads and ranged GETs. With --tls it
+generates a CA and writes its certificate for the --ca-file of clients;
+--server-name adds a host to the certificate and to virtual-hosted style.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		cobra.CheckErr(server.Serve(cfg))
+	},
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/syncdir"
+)
+
+// syncCmd synchronizes a local directory and a bucket prefix
+var syncCmd = &cobra.Command{
+	Use:   "sync <source> <destination>",
+	Short: "Synchronize a local directory and an s3://bucket/prefix, in either direction",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		setSlogDebug(cmd)
+		mergeCobraAndViper(cmd)
+		slogInfoVerbose(cmd)
+		cfg := config.MakeConfig(cmd)
+		syncdir.Sync(cfg, args[0], args[1])
+	},
+}
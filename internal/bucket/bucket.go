@@ -0,0 +1,128 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/listing"
+	"github.com/vskurikhin/awsfiles/internal/multipart"
+	"github.com/vskurikhin/awsfiles/internal/remove"
+)
+
+// usEast1 is the region that must not be sent as a location constraint.
+const usEast1 = "us-east-1"
+
+// MakeBucket creates the bucket in the location constraint, or the
+// region, optionally with object lock enabled.
+func MakeBucket(cfg config.Config, bucket string) error {
+	input := &s3.CreateBucketInput{
+		Bucket:                     aws.String(bucket),
+		ObjectLockEnabledForBucket: cfg.ObjectLock,
+	}
+	location := cfg.LocationConstraint
+	if location == "" {
+		location = cfg.Region
+	}
+	if location != "" && location != usEast1 {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(location),
+		}
+	}
+	if _, err := client.New(cfg).CreateBucket(context.Background(), input); err != nil {
+		return err
+	}
+	slog.Info("Make bucket", "result", fmt.Sprintf("s3://%s", bucket))
+	return nil
+}
+
+// RemoveBucket deletes the bucket. With cfg.Force it is emptied first:
+// objects, object versions and incomplete multipart uploads.
+func RemoveBucket(cfg config.Config, bucket string) error {
+	ctx := context.Background()
+	s3Client := client.New(cfg)
+	if cfg.Force {
+		if err := empty(ctx, cfg, s3Client, bucket); err != nil {
+			return err
+		}
+	}
+	_, err := s3Client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return err
+	}
+	slog.Info("Remove bucket", "result", fmt.Sprintf("s3://%s", bucket))
+	return nil
+}
+
+func empty(ctx context.Context, cfg config.Config, s3Client *s3.Client, bucket string) error {
+	var summary remove.Summary
+	var keys []string
+	err := listing.Walk(ctx, s3Client, bucket, "", true, func(e listing.Entry) bool {
+		keys = append(keys, e.Key)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	remove.DeleteKeys(ctx, cfg, s3Client, bucket, keys, &summary)
+	if err = deleteVersions(ctx, s3Client, bucket, &summary); err != nil && !isNotImplemented(err) {
+		return err
+	}
+	if err = abortUploads(ctx, s3Client, bucket); err != nil && !isNotImplemented(err) {
+		return err
+	}
+	if summary.Failed.Load() > 0 {
+		return fmt.Errorf("failed to delete %d objects", summary.Failed.Load())
+	}
+	return nil
+}
+
+// deleteVersions removes the versions and delete markers left by a
+// versioned bucket.
+func deleteVersions(ctx context.Context, s3Client *s3.Client, bucket string, summary *remove.Summary) error {
+	input := &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)}
+	for {
+		out, err := s3Client.ListObjectVersions(ctx, input)
+		if err != nil {
+			return err
+		}
+		var ids []types.ObjectIdentifier
+		for _, v := range out.Versions {
+			ids = append(ids, types.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+		}
+		for _, m := range out.DeleteMarkers {
+			ids = append(ids, types.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+		}
+		if len(ids) > 0 {
+			res, err := s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+				Bucket: aws.String(bucket),
+				Delete: &types.Delete{Objects: ids, Quiet: true},
+			})
+			if err != nil {
+				return err
+			}
+			summary.Failed.Add(int64(len(res.Errors)))
+		}
+		if !out.IsTruncated {
+			return nil
+		}
+		input.KeyMarker, input.VersionIdMarker = out.NextKeyMarker, out.NextVersionIdMarker
+	}
+}
+
+func abortUploads(ctx context.Context, s3Client *s3.Client, bucket string) error {
+	return multipart.Walk(ctx, s3Client, bucket, "", func(u multipart.Upload) error {
+		_, err := s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(u.Key),
+			UploadId: aws.String(u.UploadID),
+		})
+		return err
+	})
+}
@@ -0,0 +1,200 @@
+package bucket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+// notConfigured are the error codes of a configuration that is not set.
+var notConfigured = map[string]bool{
+	"NoSuchBucketPolicy":                             true,
+	"NoSuchCORSConfiguration":                        true,
+	"NoSuchLifecycleConfiguration":                   true,
+	"NoSuchTagSet":                                   true,
+	"ObjectLockConfigurationNotFoundError":           true,
+	"ServerSideEncryptionConfigurationNotFoundError": true,
+}
+
+// Info is the configuration of a bucket. A nil section is not configured,
+// Unsupported lists the sections the backend does not implement.
+type Info struct {
+	Bucket      string                                   `json:"bucket"`
+	Location    string                                   `json:"location"`
+	Versioning  *s3.GetBucketVersioningOutput            `json:"versioning,omitempty"`
+	Encryption  *types.ServerSideEncryptionConfiguration `json:"encryption,omitempty"`
+	Lifecycle   []types.LifecycleRule                    `json:"lifecycle,omitempty"`
+	Policy      string                                   `json:"policy,omitempty"`
+	CORS        []types.CORSRule                         `json:"cors,omitempty"`
+	Tagging     []types.Tag                              `json:"tagging,omitempty"`
+	ObjectLock  *types.ObjectLockConfiguration           `json:"object_lock,omitempty"`
+	Unsupported []string                                 `json:"unsupported,omitempty"`
+}
+
+// PrintInfo prints the versioning, encryption, lifecycle, policy, CORS,
+// tagging and object lock configuration of the bucket in one view.
+func PrintInfo(cfg config.Config, bucket string) error {
+	info, err := GetInfo(context.Background(), client.New(cfg), bucket)
+	if err != nil {
+		return err
+	}
+	if cfg.Format == config.FormatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	printInfo(info)
+	return nil
+}
+
+func GetInfo(ctx context.Context, s3Client *s3.Client, bucket string) (Info, error) {
+	info := Info{Bucket: bucket}
+	b := aws.String(bucket)
+	check := func(section string, err error) error {
+		switch {
+		case err == nil, isNotConfigured(err):
+			return nil
+		case isNotImplemented(err):
+			info.Unsupported = append(info.Unsupported, section)
+			return nil
+		}
+		return fmt.Errorf("%s: %w", section, err)
+	}
+	location, err := s3Client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: b})
+	if err = check("location", err); err != nil {
+		return info, err
+	} else if location != nil {
+		info.Location = string(location.LocationConstraint)
+		if info.Location == "" {
+			info.Location = usEast1
+		}
+	}
+	info.Versioning, err = s3Client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: b})
+	if err = check("versioning", err); err != nil {
+		return info, err
+	}
+	encryption, err := s3Client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: b})
+	if err = check("encryption", err); err != nil {
+		return info, err
+	} else if encryption != nil {
+		info.Encryption = encryption.ServerSideEncryptionConfiguration
+	}
+	lifecycle, err := s3Client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: b})
+	if err = check("lifecycle", err); err != nil {
+		return info, err
+	} else if lifecycle != nil {
+		info.Lifecycle = lifecycle.Rules
+	}
+	policy, err := s3Client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: b})
+	if err = check("policy", err); err != nil {
+		return info, err
+	} else if policy != nil {
+		info.Policy = aws.ToString(policy.Policy)
+	}
+	cors, err := s3Client.GetBucketCors(ctx, &s3.GetBucketCorsInput{Bucket: b})
+	if err = check("cors", err); err != nil {
+		return info, err
+	} else if cors != nil {
+		info.CORS = cors.CORSRules
+	}
+	tagging, err := s3Client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: b})
+	if err = check("tagging", err); err != nil {
+		return info, err
+	} else if tagging != nil {
+		info.Tagging = tagging.TagSet
+	}
+	lock, err := s3Client.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{Bucket: b})
+	if err = check("object lock", err); err != nil {
+		return info, err
+	} else if lock != nil {
+		info.ObjectLock = lock.ObjectLockConfiguration
+	}
+	return info, nil
+}
+
+func printInfo(info Info) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	line := func(name, format string, args ...any) {
+		_, _ = fmt.Fprintf(tw, "%s:\t"+format+"\n", append([]any{name}, args...)...)
+	}
+	line("Bucket", "%s", info.Bucket)
+	line("Location", "%s", info.Location)
+	if v := info.Versioning; v != nil && v.Status != "" {
+		line("Versioning", "%s (MFA delete: %s)", v.Status, orNone(string(v.MFADelete)))
+	} else {
+		line("Versioning", "none")
+	}
+	var rules []string
+	if info.Encryption != nil {
+		for _, r := range info.Encryption.Rules {
+			if d := r.ApplyServerSideEncryptionByDefault; d != nil {
+				rule := string(d.SSEAlgorithm)
+				if d.KMSMasterKeyID != nil {
+					rule += " " + *d.KMSMasterKeyID
+				}
+				rules = append(rules, rule)
+			}
+		}
+	}
+	line("Encryption", "%s", orNone(strings.Join(rules, ", ")))
+	rules = rules[:0]
+	for _, r := range info.Lifecycle {
+		rules = append(rules, fmt.Sprintf("%s (%s)", aws.ToString(r.ID), r.Status))
+	}
+	line("Lifecycle", "%s", orNone(strings.Join(rules, ", ")))
+	line("Policy", "%s", orNone(info.Policy))
+	rules = rules[:0]
+	for _, r := range info.CORS {
+		rules = append(rules, fmt.Sprintf("%s from %s",
+			strings.Join(r.AllowedMethods, ","), strings.Join(r.AllowedOrigins, ",")))
+	}
+	line("CORS", "%s", orNone(strings.Join(rules, "; ")))
+	rules = rules[:0]
+	for _, t := range info.Tagging {
+		rules = append(rules, aws.ToString(t.Key)+"="+aws.ToString(t.Value))
+	}
+	line("Tagging", "%s", orNone(strings.Join(rules, ", ")))
+	if l := info.ObjectLock; l != nil && l.ObjectLockEnabled != "" {
+		lock := string(l.ObjectLockEnabled)
+		if l.Rule != nil && l.Rule.DefaultRetention != nil {
+			r := l.Rule.DefaultRetention
+			lock += fmt.Sprintf(", %s %d days %d years", r.Mode, r.Days, r.Years)
+		}
+		line("Object lock", "%s", lock)
+	} else {
+		line("Object lock", "none")
+	}
+	if len(info.Unsupported) > 0 {
+		line("Unsupported", "%s", strings.Join(info.Unsupported, ", "))
+	}
+	_ = tw.Flush()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+func isNotConfigured(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && notConfigured[apiErr.ErrorCode()]
+}
+
+func isNotImplemented(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotImplemented"
+}
@@ -0,0 +1,63 @@
+package chaos
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// chunkSize is the most a faultReader reads at once, keeping the pace of
+// a bandwidth cap even.
+const chunkSize = 32 * 1024
+
+var errCut = errors.New("chaos: body cut")
+
+var _ io.Reader = (*faultReader)(nil)
+
+// faultReader applies the body faults of a rule while the body is read:
+// it paces the reads to the bandwidth, flips the byte at the corrupt
+// offset and fails with errCut at the cut offset.
+type faultReader struct {
+	r         io.Reader
+	n         int64
+	bandwidth int64
+	corrupt   int64
+	cut       int64 // -1 never
+	reset     bool  // the cut is a reset, not a close
+	start     time.Time
+	// Cut is set once the reader failed with errCut.
+	Cut bool
+}
+
+// newFaultReader applies the body faults of the rule to r, reset and
+// truncate being the cut for a response body, reset alone for a request.
+func newFaultReader(r io.Reader, rule *Rule, response bool) *faultReader {
+	f := &faultReader{r: r, bandwidth: rule.Bandwidth, corrupt: rule.Corrupt, cut: rule.Reset, reset: rule.Reset >= 0, start: time.Now()}
+	if response && rule.Truncate >= 0 && (f.cut < 0 || rule.Truncate < f.cut) {
+		f.cut, f.reset = rule.Truncate, false
+	}
+	return f
+}
+
+func (f *faultReader) Read(p []byte) (int, error) {
+	if f.cut >= 0 && f.n >= f.cut {
+		f.Cut = true
+		return 0, errCut
+	}
+	if f.cut >= 0 && int64(len(p)) > f.cut-f.n {
+		p = p[:f.cut-f.n]
+	}
+	if f.bandwidth > 0 && len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	n, err := f.r.Read(p)
+	if f.corrupt >= f.n && f.corrupt < f.n+int64(n) {
+		p[f.corrupt-f.n] ^= 0xff
+	}
+	f.n += int64(n)
+	if f.bandwidth > 0 {
+		due := f.start.Add(time.Duration(float64(f.n) / float64(f.bandwidth) * float64(time.Second)))
+		time.Sleep(time.Until(due))
+	}
+	return n, err
+}
@@ -0,0 +1,132 @@
+package chaos
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// target is what a request is about, for the rules to match.
+type target struct {
+	op     string
+	bucket string
+	key    string
+}
+
+// subresources are the query parameters that make a request of a bucket
+// or an object another operation, with the name that operation has.
+var subresources = []struct{ param, name string }{
+	{"acl", "Acl"},
+	{"attributes", "Attributes"},
+	{"cors", "Cors"},
+	{"encryption", "Encryption"},
+	{"legal-hold", "LegalHold"},
+	{"lifecycle", "LifecycleConfiguration"},
+	{"location", "Location"},
+	{"logging", "Logging"},
+	{"notification", "NotificationConfiguration"},
+	{"object-lock", "ObjectLockConfiguration"},
+	{"policy", "Policy"},
+	{"replication", "Replication"},
+	{"retention", "Retention"},
+	{"tagging", "Tagging"},
+	{"versioning", "Versioning"},
+	{"website", "Website"},
+}
+
+// methodVerbs prefix the subresource operations.
+var methodVerbs = map[string]string{
+	http.MethodGet:    "Get",
+	http.MethodPut:    "Put",
+	http.MethodDelete: "Delete",
+}
+
+// targetOf names the S3 operation of the request, taking <bucket>.<domain>
+// hosts for virtual-hosted style.
+func targetOf(r *http.Request, domains []string) target {
+	var t target
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, domain := range domains {
+		if bucket, ok := strings.CutSuffix(host, "."+domain); ok && bucket != "" {
+			t.bucket, t.key = bucket, strings.TrimPrefix(r.URL.Path, "/")
+			break
+		}
+	}
+	if t.bucket == "" {
+		t.bucket, t.key, _ = strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	}
+	t.op = operation(r.Method, r.URL.Query(), r.Header, t.bucket, t.key)
+	return t
+}
+
+func operation(method string, q url.Values, header http.Header, bucket, key string) string {
+	if bucket == "" {
+		return "ListBuckets"
+	}
+	kind := "Bucket"
+	if key != "" {
+		kind = "Object"
+	}
+	for _, sub := range subresources {
+		if q.Has(sub.param) && methodVerbs[method] != "" {
+			return methodVerbs[method] + kind + sub.name
+		}
+	}
+	if key == "" {
+		return bucketOperation(method, q)
+	}
+	copySource := header.Get("X-Amz-Copy-Source") != ""
+	switch {
+	case method == http.MethodPut && q.Has("partNumber") && copySource:
+		return "UploadPartCopy"
+	case method == http.MethodPut && q.Has("partNumber"):
+		return "UploadPart"
+	case method == http.MethodPut && copySource:
+		return "CopyObject"
+	case method == http.MethodPut:
+		return "PutObject"
+	case method == http.MethodGet && q.Has("uploadId"):
+		return "ListParts"
+	case method == http.MethodGet:
+		return "GetObject"
+	case method == http.MethodHead:
+		return "HeadObject"
+	case method == http.MethodDelete && q.Has("uploadId"):
+		return "AbortMultipartUpload"
+	case method == http.MethodDelete:
+		return "DeleteObject"
+	case method == http.MethodPost && q.Has("uploads"):
+		return "CreateMultipartUpload"
+	case method == http.MethodPost && q.Has("uploadId"):
+		return "CompleteMultipartUpload"
+	case method == http.MethodPost && q.Has("restore"):
+		return "RestoreObject"
+	}
+	return method + kind
+}
+
+func bucketOperation(method string, q url.Values) string {
+	switch {
+	case method == http.MethodGet && q.Has("uploads"):
+		return "ListMultipartUploads"
+	case method == http.MethodGet && q.Has("versions"):
+		return "ListObjectVersions"
+	case method == http.MethodGet && q.Get("list-type") == "2":
+		return "ListObjectsV2"
+	case method == http.MethodGet:
+		return "ListObjects"
+	case method == http.MethodHead:
+		return "HeadBucket"
+	case method == http.MethodPut:
+		return "CreateBucket"
+	case method == http.MethodDelete:
+		return "DeleteBucket"
+	case method == http.MethodPost && q.Has("delete"):
+		return "DeleteObjects"
+	}
+	return method + "Bucket"
+}
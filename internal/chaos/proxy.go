@@ -0,0 +1,317 @@
+// Package chaos is a fault-injection proxy in front of an S3 endpoint: the
+// requests its rules match by operation, bucket or key get added latency,
+// a bandwidth cap, reset or truncated connections, S3 errors or corrupted
+// bytes, to exercise the retry, resume and checksum handling of clients.
+package chaos
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+const (
+	headerRequestID = "X-Amz-Request-Id"
+	// shutdownTimeout is how long requests in flight get on shutdown.
+	shutdownTimeout = 10 * time.Second
+)
+
+// hopHeaders are the headers of one connection, not forwarded.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Options configure a Proxy.
+type Options struct {
+	// Domains take virtual-hosted style requests, <bucket>.<domain>.
+	Domains []string
+	// Seed makes the rules with a probability fire the same way each run,
+	// zero picks one.
+	Seed    int64
+	Verbose bool
+}
+
+// Proxy forwards requests through transport, injecting the faults of the
+// first rule that fires.
+type Proxy struct {
+	rules     []*Rule
+	transport http.RoundTripper
+	opts      Options
+	mu        sync.Mutex
+	random    *mrand.Rand
+}
+
+func New(rules []*Rule, transport http.RoundTripper, opts Options) *Proxy {
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	return &Proxy{rules: rules, transport: transport, opts: opts, random: mrand.New(mrand.NewSource(opts.Seed))}
+}
+
+// Run runs the proxy on cfg.Listen in front of the endpoint of cfg until
+// interrupted, then reports how often each rule fired.
+func Run(cfg config.Config) error {
+	if cfg.S3Host == "" {
+		return errors.New("no endpoint to forward to, set --s3-host")
+	}
+	rules, err := Rules(cfg)
+	if err != nil {
+		return err
+	}
+	domains := []string{"localhost"}
+	if u, err := url.Parse(cfg.S3Host); err == nil && u.Hostname() != "" && net.ParseIP(u.Hostname()) == nil {
+		domains = append(domains, u.Hostname())
+	}
+	if cfg.ServerName != "" {
+		domains = append(domains, cfg.ServerName)
+	}
+	proxy := New(rules, client.HTTPClient(cfg).Transport, Options{Domains: domains, Seed: cfg.Seed, Verbose: cfg.Verbose})
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	slog.Info("Chaos proxy", "result", fmt.Sprintf("http://%s -> %s (%s), rules: %d", ln.Addr(), cfg.S3Host, cfg.Address, len(rules)))
+	httpServer := &http.Server{Handler: proxy, ReadHeaderTimeout: time.Minute}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdown)
+	}()
+	if err = httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	for i, rule := range rules {
+		matched, faulted := rule.Counts()
+		slog.Info("Chaos proxy", "result", fmt.Sprintf("rule %d: matched %d, faulted %d: %s", i+1, matched, faulted, rule.Spec))
+	}
+	return nil
+}
+
+// Rules parses the --rule rules of cfg followed by those of the
+// --rules-file.
+func Rules(cfg config.Config) ([]*Rule, error) {
+	var rules []*Rule
+	for _, spec := range cfg.Rule {
+		rule, err := ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if cfg.RulesFile != "" {
+		more, err := ReadRules(cfg.RulesFile)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, more...)
+	}
+	return rules, nil
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	t := targetOf(r, p.opts.Domains)
+	rule := p.match(t)
+	if rule != nil {
+		slog.Info("Chaos proxy", "op", t.op, "bucket", t.bucket, "key", t.key, "fault", rule.faults())
+	}
+	status := p.serve(w, r, rule)
+	if p.opts.Verbose {
+		slog.Info("Chaos proxy", "request", fmt.Sprintf("%s %s %s %s %s", r.Method, r.URL.RequestURI(), t.op, status, time.Since(start).Round(time.Microsecond)))
+	}
+}
+
+// match returns the first rule that fires for t, or nil.
+func (p *Proxy) match(t target) *Rule {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, rule := range p.rules {
+		if rule.fires(t, p.random) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// serve forwards the request with the faults of rule, which may be nil,
+// and describes the outcome for the request log.
+func (p *Proxy) serve(w http.ResponseWriter, r *http.Request, rule *Rule) string {
+	if rule == nil {
+		rule = &Rule{Reset: -1, Truncate: -1, Corrupt: -1}
+	}
+	if rule.Latency > 0 {
+		select {
+		case <-time.After(rule.Latency):
+		case <-r.Context().Done():
+			return "canceled"
+		}
+	}
+	if rule.Status != 0 {
+		writeError(w, r, rule.Status, rule.errorCode())
+		return fmt.Sprint(rule.Status)
+	}
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.URL.Scheme = "http"
+	out.URL.Host = r.Host
+	removeHopHeaders(out.Header)
+	var requestBody *faultReader
+	if rule.Body == BodyRequest && r.ContentLength != 0 {
+		requestBody = newFaultReader(r.Body, rule, false)
+		out.Body = io.NopCloser(requestBody)
+	}
+	res, err := p.transport.RoundTrip(out)
+	if requestBody != nil && requestBody.Cut {
+		if err == nil {
+			_ = res.Body.Close()
+		}
+		cutConnection(w, true)
+		return "reset"
+	}
+	if err != nil {
+		slog.Error("Chaos proxy failed", "err", err)
+		writeError(w, r, http.StatusBadGateway, "BadGateway")
+		return fmt.Sprint(http.StatusBadGateway)
+	}
+	defer func() { _ = res.Body.Close() }()
+	removeHopHeaders(res.Header)
+	for name, values := range res.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(res.StatusCode)
+	body := io.Reader(res.Body)
+	var responseBody *faultReader
+	if rule.Body == BodyResponse {
+		responseBody = newFaultReader(res.Body, rule, true)
+		body = responseBody
+	}
+	if err = copyResponse(w, body, rule.Bandwidth > 0); responseBody != nil && responseBody.Cut {
+		cutConnection(w, responseBody.reset)
+		if responseBody.reset {
+			return "reset"
+		}
+		return "truncated"
+	} else if err != nil {
+		slog.Error("Chaos proxy failed", "err", err)
+	}
+	return fmt.Sprint(res.StatusCode)
+}
+
+// copyResponse copies the body to w, flushing every write when paced so
+// that the client sees the pace.
+func copyResponse(w http.ResponseWriter, body io.Reader, flush bool) error {
+	rc := http.NewResponseController(w)
+	b := make([]byte, chunkSize)
+	for {
+		n, err := body.Read(b)
+		if n > 0 {
+			if _, werr := w.Write(b[:n]); werr != nil {
+				return werr
+			}
+			if flush {
+				_ = rc.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// cutConnection sends what was written and drops the client connection,
+// with a TCP reset when reset, or aborts the handler when it can not.
+func cutConnection(w http.ResponseWriter, reset bool) {
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	_ = buf.Flush()
+	if tcp, ok := conn.(*net.TCPConn); ok && reset {
+		_ = tcp.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, name := range header.Values("Connection") {
+		for _, field := range strings.Split(name, ",") {
+			header.Del(strings.TrimSpace(field))
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// errorMessages are the messages S3 sends with the codes.
+var errorMessages = map[string]string{
+	"InternalError": "We encountered an internal error. Please try again.",
+	"SlowDown":      "Please reduce your request rate.",
+}
+
+// writeError answers with an S3 error, without a body for HEAD.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	id := newID(8)
+	w.Header().Set(headerRequestID, id)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	message, ok := errorMessages[code]
+	if !ok {
+		message = "Injected by chaos-proxy."
+	}
+	body, err := xml.Marshal(errorResponse{Code: code, Message: message, Resource: r.URL.Path, RequestID: id})
+	if err != nil {
+		slog.Error("Chaos proxy failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(body)
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return strings.ToUpper(hex.EncodeToString(b))
+}
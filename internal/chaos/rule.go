@@ -0,0 +1,292 @@
+package chaos
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+// The directions of the body faults.
+const (
+	BodyRequest  = "request"
+	BodyResponse = "response"
+)
+
+// Rule injects its faults into the requests it matches. The zero values
+// of the faults are off, an offset of -1 too.
+type Rule struct {
+	// Spec is the text the rule was parsed from.
+	Spec string
+	// Ops, Buckets and Keys are globs, the key ones matching the full key
+	// or its base name; empty ones match anything.
+	Ops     []string
+	Buckets []string
+	Keys    []string
+	// P is the probability a matching request gets the faults.
+	P float64
+	// After skips the first matching requests, Times limits the faulted
+	// ones, zero is unlimited.
+	After int
+	Times int
+
+	Latency time.Duration
+	// Status answers with an S3 error instead of forwarding, Code being
+	// its error code.
+	Status int
+	Code   string
+	// Body is the body the faults below apply to, BodyResponse or
+	// BodyRequest.
+	Body string
+	// Bandwidth caps the body at so many bytes per second.
+	Bandwidth int64
+	// Reset resets the connection, Truncate closes it, after so many bytes
+	// of the body.
+	Reset    int64
+	Truncate int64
+	// Corrupt flips the byte at this offset of the body.
+	Corrupt int64
+
+	mu      sync.Mutex
+	matched int
+	faulted int
+}
+
+// ParseRule reads a rule of space-separated name=value fields:
+//
+//	op=PutObject|UploadPart   operations, globs separated by |
+//	bucket=logs-*             buckets, globs separated by |
+//	key=*.bin|data/*          keys, globs on the full key or base name
+//	p=0.1                     probability, 1 by default
+//	after=2 times=3           skip 2 matching requests, then fault 3
+//	latency=2s                delay before forwarding
+//	status=503 code=SlowDown  an S3 error instead of forwarding
+//	body=request              the body of the faults below, response by default
+//	bandwidth=256KiB          bytes per second of the body
+//	reset=1MiB                reset the connection after so many body bytes
+//	truncate=1MiB             close the connection after so many body bytes
+//	corrupt=1000              flip the byte at this offset of the body
+func ParseRule(spec string) (*Rule, error) {
+	r := &Rule{Spec: spec, P: 1, Body: BodyResponse, Reset: -1, Truncate: -1, Corrupt: -1}
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty rule")
+	}
+	for _, field := range fields {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("rule %q: %q is not name=value", spec, field)
+		}
+		if err := r.set(name, value); err != nil {
+			return nil, fmt.Errorf("rule %q: %s: %w", spec, name, err)
+		}
+	}
+	if err := r.validate(); err != nil {
+		return nil, fmt.Errorf("rule %q: %w", spec, err)
+	}
+	return r, nil
+}
+
+func (r *Rule) set(name, value string) error {
+	var err error
+	switch name {
+	case "op":
+		r.Ops, err = globs(value)
+	case "bucket":
+		r.Buckets, err = globs(value)
+	case "key":
+		r.Keys, err = globs(value)
+	case "p":
+		r.P, err = strconv.ParseFloat(value, 64)
+		if err == nil && (r.P < 0 || r.P > 1) {
+			err = fmt.Errorf("%v is not in [0, 1]", r.P)
+		}
+	case "after":
+		r.After, err = count(value)
+	case "times":
+		r.Times, err = count(value)
+	case "latency":
+		r.Latency, err = time.ParseDuration(value)
+	case "status":
+		r.Status, err = strconv.Atoi(value)
+		if err == nil && (r.Status < 400 || r.Status > 599) {
+			err = fmt.Errorf("%d is no error status", r.Status)
+		}
+	case "code":
+		r.Code = value
+	case "body":
+		if value != BodyRequest && value != BodyResponse {
+			err = fmt.Errorf("%q is neither %s nor %s", value, BodyRequest, BodyResponse)
+		}
+		r.Body = value
+	case "bandwidth":
+		r.Bandwidth, err = tool.ParseByteSize(value)
+		if err == nil && r.Bandwidth == 0 {
+			err = fmt.Errorf("zero bandwidth")
+		}
+	case "reset":
+		r.Reset, err = tool.ParseByteSize(value)
+	case "truncate":
+		r.Truncate, err = tool.ParseByteSize(value)
+	case "corrupt":
+		r.Corrupt, err = tool.ParseByteSize(value)
+	default:
+		err = fmt.Errorf("unknown field")
+	}
+	return err
+}
+
+func (r *Rule) validate() error {
+	bodyFaults := r.Bandwidth > 0 || r.Reset >= 0 || r.Truncate >= 0 || r.Corrupt >= 0
+	switch {
+	case r.Status == 0 && r.Code != "":
+		return fmt.Errorf("code without status")
+	case r.Status != 0 && bodyFaults:
+		return fmt.Errorf("status answers without a body to fault")
+	case r.Truncate >= 0 && r.Body == BodyRequest:
+		return fmt.Errorf("truncate is of the response body, reset cuts the request")
+	case r.Latency == 0 && r.Status == 0 && !bodyFaults:
+		return fmt.Errorf("no fault")
+	}
+	return nil
+}
+
+// globs splits the |-separated patterns, checking them.
+func globs(value string) ([]string, error) {
+	patterns := strings.Split(value, "|")
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+	return patterns, nil
+}
+
+func count(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err == nil && n < 0 {
+		err = fmt.Errorf("negative count %d", n)
+	}
+	return n, err
+}
+
+// ReadRules reads a rule per line of the file, skipping blank lines and
+// # comments.
+func ReadRules(name string) ([]*Rule, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	var rules []*Rule
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		rule, err := ParseRule(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// fires reports whether the faults apply to the request of t, counting
+// it when it matches.
+func (r *Rule) fires(t target, random *rand.Rand) bool {
+	if !matchAny(r.Ops, t.op, false) || !matchAny(r.Buckets, t.bucket, false) || !matchAny(r.Keys, t.key, true) {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.matched++
+	if r.matched <= r.After || r.Times > 0 && r.faulted >= r.Times {
+		return false
+	}
+	if r.P < 1 && random.Float64() >= r.P {
+		return false
+	}
+	r.faulted++
+	return true
+}
+
+// Counts returns how many requests matched the rule and how many of them
+// got the faults.
+func (r *Rule) Counts() (matched, faulted int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.matched, r.faulted
+}
+
+// faults describes the faults of the rule for the log.
+func (r *Rule) faults() string {
+	var s []string
+	if r.Latency > 0 {
+		s = append(s, "latency="+r.Latency.String())
+	}
+	if r.Status != 0 {
+		s = append(s, fmt.Sprintf("status=%d %s", r.Status, r.errorCode()))
+	}
+	if r.Bandwidth > 0 {
+		s = append(s, fmt.Sprintf("bandwidth=%s/s", tool.FormatByteSize(r.Bandwidth)))
+	}
+	if r.Reset >= 0 {
+		s = append(s, fmt.Sprintf("reset=%d", r.Reset))
+	}
+	if r.Truncate >= 0 {
+		s = append(s, fmt.Sprintf("truncate=%d", r.Truncate))
+	}
+	if r.Corrupt >= 0 {
+		s = append(s, fmt.Sprintf("corrupt=%d", r.Corrupt))
+	}
+	if r.Bandwidth > 0 || r.Reset >= 0 || r.Truncate >= 0 || r.Corrupt >= 0 {
+		s = append(s, "body="+r.Body)
+	}
+	return strings.Join(s, " ")
+}
+
+// errorCode is Code, or the S3 code of Status.
+func (r *Rule) errorCode() string {
+	if r.Code != "" {
+		return r.Code
+	}
+	switch r.Status {
+	case http.StatusInternalServerError:
+		return "InternalError"
+	case http.StatusServiceUnavailable:
+		return "SlowDown"
+	case http.StatusForbidden:
+		return "AccessDenied"
+	case http.StatusNotFound:
+		return "NoSuchKey"
+	case http.StatusRequestTimeout:
+		return "RequestTimeout"
+	}
+	return strings.ReplaceAll(http.StatusText(r.Status), " ", "")
+}
+
+func matchAny(patterns []string, value string, base bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(value)); base && value != "" && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package chaos
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    *Rule
+		wantErr bool
+	}{
+		{
+			spec: "op=PutObject|UploadPart status=503",
+			want: &Rule{Ops: []string{"PutObject", "UploadPart"}, P: 1, Status: 503, Body: BodyResponse, Reset: -1, Truncate: -1, Corrupt: -1},
+		},
+		{
+			spec: "bucket=logs-* key=*.bin p=0.25 after=2 times=3 latency=150ms",
+			want: &Rule{Buckets: []string{"logs-*"}, Keys: []string{"*.bin"}, P: 0.25, After: 2, Times: 3, Latency: 150 * time.Millisecond, Body: BodyResponse, Reset: -1, Truncate: -1, Corrupt: -1},
+		},
+		{
+			spec: "status=500 code=InternalError",
+			want: &Rule{P: 1, Status: 500, Code: "InternalError", Body: BodyResponse, Reset: -1, Truncate: -1, Corrupt: -1},
+		},
+		{
+			spec: "bandwidth=256KiB truncate=1MiB corrupt=1000",
+			want: &Rule{P: 1, Body: BodyResponse, Bandwidth: 256 << 10, Reset: -1, Truncate: 1 << 20, Corrupt: 1000},
+		},
+		{
+			spec: "body=request reset=0",
+			want: &Rule{P: 1, Body: BodyRequest, Reset: 0, Truncate: -1, Corrupt: -1},
+		},
+		{spec: "", wantErr: true},
+		{spec: "op=GetObject", wantErr: true},
+		{spec: "status", wantErr: true},
+		{spec: "status=", wantErr: true},
+		{spec: "status=200", wantErr: true},
+		{spec: "status=teapot", wantErr: true},
+		{spec: "p=1.5 status=500", wantErr: true},
+		{spec: "after=-1 status=500", wantErr: true},
+		{spec: "latency=soon", wantErr: true},
+		{spec: "code=SlowDown latency=1s", wantErr: true},
+		{spec: "status=503 corrupt=10", wantErr: true},
+		{spec: "body=request truncate=10", wantErr: true},
+		{spec: "body=both reset=10", wantErr: true},
+		{spec: "bandwidth=0", wantErr: true},
+		{spec: "reset=1XB", wantErr: true},
+		{spec: "key=[ status=500", wantErr: true},
+		{spec: "color=red status=500", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRule(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRule(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		tt.want.Spec = tt.spec
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRule(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestReadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules")
+	text := "# slow uploads\nop=UploadPart latency=1s\n\nop=GetObject truncate=100 # cut downloads\n"
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := ReadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].Latency != time.Second || rules[1].Truncate != 100 {
+		t.Errorf("ReadRules() = %+v", rules)
+	}
+	if err = os.WriteFile(path, []byte("op=GetObject latency=1s\nop=GetObject\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadRules(path); err == nil {
+		t.Error("ReadRules() of a rule without faults did not fail")
+	}
+}
+
+func TestRuleFires(t *testing.T) {
+	rule, err := ParseRule("op=GetObject key=*.bin after=1 times=2 status=503")
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := rand.New(rand.NewSource(1))
+	get := target{op: "GetObject", bucket: "b", key: "dir/a.bin"}
+	var fired []bool
+	for i := 0; i < 4; i++ {
+		fired = append(fired, rule.fires(get, random))
+	}
+	if want := []bool{false, true, true, false}; !reflect.DeepEqual(fired, want) {
+		t.Errorf("fires() = %v, want %v", fired, want)
+	}
+	if rule.fires(target{op: "PutObject", bucket: "b", key: "a.bin"}, random) {
+		t.Error("fires() for another operation")
+	}
+	if rule.fires(target{op: "GetObject", bucket: "b", key: "a.txt"}, random) {
+		t.Error("fires() for another key")
+	}
+	if matched, faulted := rule.Counts(); matched != 4 || faulted != 2 {
+		t.Errorf("Counts() = %d, %d, want 4, 2", matched, faulted)
+	}
+}
@@ -0,0 +1,222 @@
+// Package checksum computes several hashes of a stream in one pass and
+// maps them to the additional checksums of S3.
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// The names of the checksums.
+const (
+	CRC32     = "crc32"
+	CRC32C    = "crc32c"
+	CRC64NVME = "crc64nvme"
+	MD5       = "md5"
+	SHA1      = "sha1"
+	SHA256    = "sha256"
+	SHA512    = "sha512"
+)
+
+// crc64NVMEPoly is the reversed polynomial of CRC-64/NVME.
+const crc64NVMEPoly = 0x9a6c9329ac4bc9b5
+
+// headerPrefix starts the response headers of the additional checksums.
+const headerPrefix = "X-Amz-Checksum-"
+
+var (
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+	nvme       = crc64.MakeTable(crc64NVMEPoly)
+)
+
+var constructors = map[string]func() hash.Hash{
+	CRC32:     func() hash.Hash { return crc32.NewIEEE() },
+	CRC32C:    func() hash.Hash { return crc32.New(castagnoli) },
+	CRC64NVME: func() hash.Hash { return crc64.New(nvme) },
+	MD5:       md5.New,
+	SHA1:      sha1.New,
+	SHA256:    sha256.New,
+	SHA512:    sha512.New,
+}
+
+// algorithms are the checksums the SDK can send as S3 additional
+// checksums.
+var algorithms = map[string]types.ChecksumAlgorithm{
+	CRC32:  types.ChecksumAlgorithmCrc32,
+	CRC32C: types.ChecksumAlgorithmCrc32c,
+	SHA1:   types.ChecksumAlgorithmSha1,
+	SHA256: types.ChecksumAlgorithmSha256,
+}
+
+// Validate checks the names of the checksums.
+func Validate(names []string) error {
+	for _, name := range names {
+		if _, ok := constructors[strings.ToLower(name)]; !ok {
+			return fmt.Errorf("unknown checksum %q", name)
+		}
+	}
+	return nil
+}
+
+// Set is an io.Writer hashing with several checksums at once.
+type Set struct {
+	names  []string
+	hashes []hash.Hash
+}
+
+// New returns the set of the named checksums, each once, skipping unknown
+// names; Validate reports those.
+func New(names ...string) *Set {
+	s := &Set{}
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if constructor, ok := constructors[name]; ok && !s.Has(name) {
+			s.names = append(s.names, name)
+			s.hashes = append(s.hashes, constructor())
+		}
+	}
+	return s
+}
+
+func (s *Set) Write(p []byte) (int, error) {
+	for _, h := range s.hashes {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// Names returns the checksums in the order given.
+func (s *Set) Names() []string {
+	return s.names
+}
+
+func (s *Set) Has(name string) bool {
+	return s.index(name) >= 0
+}
+
+// Sum returns the named checksum, nil when not in the set.
+func (s *Set) Sum(name string) []byte {
+	if i := s.index(name); i >= 0 {
+		return s.hashes[i].Sum(nil)
+	}
+	return nil
+}
+
+func (s *Set) index(name string) int {
+	for i, n := range s.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Hex returns the named checksum in hex, the way md5sum prints it.
+func (s *Set) Hex(name string) string {
+	return hex.EncodeToString(s.Sum(name))
+}
+
+// Base64 returns the named checksum the way S3 reports it.
+func (s *Set) Base64(name string) string {
+	return base64.StdEncoding.EncodeToString(s.Sum(name))
+}
+
+// Algorithm returns the first checksum of names S3 takes as additional
+// checksum of an upload, or "" when there is none.
+func Algorithm(names []string) types.ChecksumAlgorithm {
+	for _, name := range names {
+		if a, ok := algorithms[strings.ToLower(name)]; ok {
+			return a
+		}
+	}
+	return ""
+}
+
+// CompletedPart sets the checksum of the algorithm on the part of
+// CompleteMultipartUpload.
+func CompletedPart(part *types.CompletedPart, algorithm types.ChecksumAlgorithm, value string) {
+	if value == "" {
+		return
+	}
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32:
+		part.ChecksumCRC32 = aws.String(value)
+	case types.ChecksumAlgorithmCrc32c:
+		part.ChecksumCRC32C = aws.String(value)
+	case types.ChecksumAlgorithmSha1:
+		part.ChecksumSHA1 = aws.String(value)
+	case types.ChecksumAlgorithmSha256:
+		part.ChecksumSHA256 = aws.String(value)
+	}
+}
+
+// Values maps the checksum fields of an SDK output by name, leaving out
+// the empty ones.
+func Values(crc32, crc32c, sha1, sha256 *string) map[string]string {
+	result := make(map[string]string)
+	for name, value := range map[string]*string{CRC32: crc32, CRC32C: crc32c, SHA1: sha1, SHA256: sha256} {
+		if aws.ToString(value) != "" {
+			result[name] = aws.ToString(value)
+		}
+	}
+	return result
+}
+
+// Pick returns the value of the algorithm among the checksum fields of an
+// SDK output.
+func Pick(algorithm types.ChecksumAlgorithm, crc32, crc32c, sha1, sha256 *string) string {
+	for name, value := range Values(crc32, crc32c, sha1, sha256) {
+		if algorithms[name] == algorithm {
+			return value
+		}
+	}
+	return ""
+}
+
+// FromHeader returns the additional checksums of a response by name,
+// crc64nvme included, which the SDK does not know of.
+func FromHeader(header http.Header) map[string]string {
+	result := make(map[string]string)
+	for name, values := range header {
+		if len(values) > 0 && strings.HasPrefix(name, headerPrefix) {
+			if algorithm := strings.ToLower(strings.TrimPrefix(name, headerPrefix)); algorithm != "mode" && algorithm != "type" {
+				result[algorithm] = values[0]
+			}
+		}
+	}
+	return result
+}
+
+// Compare checks the server checksums against the set. A checksum of a
+// multipart upload is of the part checksums, "<base64>-<parts>", and can
+// not be compared with the checksum of the whole data.
+func Compare(s *Set, server map[string]string) (matched []string, skipped []string, err error) {
+	for _, name := range s.Names() {
+		value, ok := server[name]
+		if !ok {
+			continue
+		}
+		if strings.Contains(value, "-") {
+			skipped = append(skipped, name)
+			continue
+		}
+		if value != s.Base64(name) {
+			return matched, skipped, fmt.Errorf("%s mismatch: server %s, local %s", name, value, s.Base64(name))
+		}
+		matched = append(matched, name)
+	}
+	return matched, skipped, nil
+}
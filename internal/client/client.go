@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+const defaultRegion = "us-east-1"
+
+var zeroTime = new(time.Time)
+
+// New builds an S3 client that reaches the endpoint through the
+// Address/ServerName overrides of the config.
+func New(cfg config.Config) *s3.Client {
+	var creeds aws.CredentialsProvider = aws.AnonymousCredentials{}
+	if !cfg.Anonymous {
+		keys := getKeys(cfg)
+		creeds = credentials.NewStaticCredentialsProvider(keys.AccessKeyID, keys.SecretAccessKey, keys.SessionToken)
+	}
+	return s3.NewFromConfig(aws.Config{
+		Region:                      cfg.Region,
+		Credentials:                 creeds,
+		HTTPClient:                  HTTPClient(cfg),
+		EndpointResolverWithOptions: getCustomResolver(cfg),
+	})
+}
+
+// HTTPClient returns the client whose transport dials cfg.Address and
+// negotiates TLS itself, so requests are always sent to an http:// URL.
+func HTTPClient(cfg config.Config) *http.Client {
+	var tlsCfg *tls.Config
+	if cfg.Ssl() {
+		tlsCfg = createTLSClientConfig(cfg)
+	}
+	transport := &http.Transport{
+		DisableKeepAlives:     false,
+		IdleConnTimeout:       0,
+		TLSHandshakeTimeout:   0,
+		ResponseHeaderTimeout: 0,
+		ExpectContinueTimeout: 0,
+		WriteBufferSize:       cfg.BufferSize,
+		ReadBufferSize:        cfg.BufferSize,
+		TLSClientConfig:       tlsCfg,
+		DialContext:           dialContextFunc(cfg, tlsCfg),
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   0,
+	}
+}
+
+func getCustomResolver(cfg config.Config) aws.EndpointResolverWithOptionsFunc {
+	hostnameImmutable := isHostnameImmutable(cfg)
+	return func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+		if region == "" {
+			region = defaultRegion
+		}
+		if service == s3.ServiceID {
+			return aws.Endpoint{URL: cfg.S3Host, HostnameImmutable: hostnameImmutable, SigningRegion: region}, nil
+		}
+		return aws.Endpoint{}, fmt.Errorf("unknown endpoint requested")
+	}
+}
+
+// isHostnameImmutable reports whether the bucket must stay in the path.
+// In auto mode endpoints with a base path, IP addresses and single-label
+// hosts use path-style, the rest is left to the SDK.
+func isHostnameImmutable(cfg config.Config) bool {
+	switch cfg.Addressing {
+	case config.AddressingVirtual:
+		return false
+	case config.AddressingAuto:
+		u, err := url.Parse(cfg.S3Host)
+		if err != nil {
+			return true
+		}
+		host := u.Hostname()
+		return strings.Trim(u.Path, "/") != "" || net.ParseIP(host) != nil || !strings.Contains(host, ".")
+	}
+	return true
+}
+
+func createTLSClientConfig(cfg config.Config) *tls.Config {
+	certs := x509.NewCertPool()
+
+	if cfg.CAFile != "" {
+		pemData, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			slog.Error("Read certificate failed", "err", err)
+		}
+		certs.AppendCertsFromPEM(pemData)
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_AES_128_GCM_SHA256,
+			tls.TLS_AES_256_GCM_SHA384,
+			tls.TLS_CHACHA20_POLY1305_SHA256,
+		},
+		RootCAs:            certs,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		NextProtos: []string{
+			"http/1.1",
+			"h2",
+		},
+	}
+}
+
+func dialContextFunc(cfg config.Config, tlsCfg *tls.Config) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	if cfg.Ssl() {
+		return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			c := tlsCfg.Clone()
+			c.ServerName = serverName(cfg, addr)
+			conn, err := tls.Dial("tcp", cfg.Address, c)
+			if err != nil {
+				return nil, err
+			}
+			if cfg.Debug {
+				slog.Debug(
+					"connected",
+					"ServerName", conn.ConnectionState().ServerName,
+					"NegotiatedProtocol", conn.ConnectionState().NegotiatedProtocol,
+					"HandshakeComplete", conn.ConnectionState().HandshakeComplete)
+			}
+			err = conn.SetDeadline(*zeroTime)
+			return conn, err
+		}
+	}
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		conn, err := net.Dial("tcp", cfg.Address)
+		if err != nil {
+			fmt.Println("dial connection failed", "err", err)
+			return nil, err
+		}
+		err = conn.SetDeadline(*zeroTime)
+		return conn, err
+	}
+}
+
+// serverName keeps the SNI of a virtual-hosted bucket, bucket.ServerName,
+// while the connection itself still goes to cfg.Address.
+func serverName(cfg config.Config, addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err == nil && cfg.ServerName != "" && strings.HasSuffix(host, "."+cfg.ServerName) {
+		return host
+	}
+	return cfg.ServerName
+}
+
+func getKeys(cfg config.Config) aws.Credentials {
+	return aws.Credentials{
+		AccessKeyID:     cfg.AccessKeyID,
+		SecretAccessKey: cfg.SecretAccessKey,
+		SessionToken:    cfg.SessionToken,
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -12,26 +13,153 @@ import (
 	"github.com/vskurikhin/awsfiles/pkg/tool"
 )
 
+const (
+	AddressingAuto    = "auto"
+	AddressingPath    = "path"
+	AddressingVirtual = "virtual"
+)
+
+const profilesKey = "profiles"
+
+const (
+	FormatHuman = "human"
+	FormatJSON  = "json"
+	FormatLong  = "long"
+)
+
 type Config struct {
-	AccessKeyID        string `mapstructure:"access_key_id"`
-	Address            string `mapstructure:"address"`
-	Bucket             string `mapstructure:"bucket"`
-	BufferSize         int    `mapstructure:"buffer_size"`
-	CAFile             string `mapstructure:"ca_file"`
-	Debug              bool   `mapstructure:"debug"`
-	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
-	Key                string `mapstructure:"key"`
-	S3Host             string `mapstructure:"s3_host"`
-	SecretAccessKey    string `mapstructure:"secret_access_key"`
-	ServerName         string `mapstructure:"server_name"`
-	Size               int    `mapstructure:"size"`
-	Verbose            bool   `mapstructure:"verbose"`
+	AccessKeyID        string        `mapstructure:"access_key_id"`
+	Address            string        `mapstructure:"address"`
+	Addressing         string        `mapstructure:"addressing"`
+	Algorithm          string        `mapstructure:"algorithm"`
+	Anonymous          bool          `mapstructure:"anonymous"`
+	Bucket             string        `mapstructure:"bucket"`
+	BufferSize         int           `mapstructure:"buffer_size"`
+	CAFile             string        `mapstructure:"ca_file"`
+	CAOut              string        `mapstructure:"ca_out"`
+	Checkpoint         string        `mapstructure:"checkpoint"`
+	Checksum           []string      `mapstructure:"checksum"`
+	Compare            string        `mapstructure:"compare"`
+	Concurrency        int           `mapstructure:"concurrency"`
+	ContentType        string        `mapstructure:"content_type"`
+	Count              int           `mapstructure:"count"`
+	DataPattern        string        `mapstructure:"data_pattern"`
+	Debug              bool          `mapstructure:"debug"`
+	Delete             bool          `mapstructure:"delete"`
+	DestProfile        string        `mapstructure:"dest_profile"`
+	DryRun             bool          `mapstructure:"dry_run"`
+	Exclude            []string      `mapstructure:"exclude"`
+	Expires            time.Duration `mapstructure:"expires"`
+	Force              bool          `mapstructure:"force"`
+	Format             string        `mapstructure:"format"`
+	IfMatch            string        `mapstructure:"if_match"`
+	IfModifiedSince    string        `mapstructure:"if_modified_since"`
+	IfNoneMatch        string        `mapstructure:"if_none_match"`
+	Include            []string      `mapstructure:"include"`
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify"`
+	Key                string        `mapstructure:"key"`
+	LeavePartsOnError  bool          `mapstructure:"leave_parts_on_error"`
+	Listen             string        `mapstructure:"listen"`
+	LocationConstraint string        `mapstructure:"location_constraint"`
+	MaxKeys            int           `mapstructure:"max_keys"`
+	MaxSize            ByteSize      `mapstructure:"max_size"`
+	Metadata           []string      `mapstructure:"metadata"`
+	MetadataDirective  string        `mapstructure:"metadata_directive"`
+	MinSize            ByteSize      `mapstructure:"min_size"`
+	NewerThan          time.Duration `mapstructure:"newer_than"`
+	ObjectLock         bool          `mapstructure:"object_lock"`
+	OlderThan          time.Duration `mapstructure:"older_than"`
+	Output             string        `mapstructure:"output"`
+	PartSize           ByteSize      `mapstructure:"part_size"`
+	Prefix             string        `mapstructure:"prefix"`
+	Profile            string        `mapstructure:"profile"`
+	Recursive          bool          `mapstructure:"recursive"`
+	Regex              string        `mapstructure:"regex"`
+	Region             string        `mapstructure:"region"`
+	Resume             bool          `mapstructure:"resume"`
+	Retries            int           `mapstructure:"retries"`
+	Root               string        `mapstructure:"root"`
+	Rule               []string      `mapstructure:"rule"`
+	RulesFile          string        `mapstructure:"rules_file"`
+	S3Host             string        `mapstructure:"s3_host"`
+	SecretAccessKey    string        `mapstructure:"secret_access_key"`
+	Seed               int64         `mapstructure:"seed"`
+	ServerName         string        `mapstructure:"server_name"`
+	SessionToken       string        `mapstructure:"session_token"`
+	Size               string        `mapstructure:"size"`
+	SourceProfile      string        `mapstructure:"source_profile"`
+	SSECustomerKey     string        `mapstructure:"sse_customer_key"`
+	StateFile          string        `mapstructure:"state_file"`
+	StorageClass       string        `mapstructure:"storage_class"`
+	TLS                bool          `mapstructure:"tls"`
+	URL                string        `mapstructure:"url"`
+	Verbose            bool          `mapstructure:"verbose"`
+	Verify             bool          `mapstructure:"verify"`
+	VerifyGenerated    bool          `mapstructure:"verify_generated"`
+	Wait               time.Duration `mapstructure:"wait"`
 	ssl                bool
 }
 
+// endpointKeys are the connection settings a profile does not inherit.
+var endpointKeys = map[string]bool{
+	"access_key_id":        true,
+	"address":              true,
+	"addressing":           true,
+	"anonymous":            true,
+	"ca_file":              true,
+	"insecure_skip_verify": true,
+	"region":               true,
+	"s3_host":              true,
+	"secret_access_key":    true,
+	"server_name":          true,
+	"session_token":        true,
+}
+
 func MakeConfig(cmd *cobra.Command) Config {
+	if profile := viper.GetString("profile"); profile != "" {
+		cfg, err := makeProfileConfig(cmd, profile)
+		// Without the profile the command would run against the default
+		// endpoint.
+		cobra.CheckErr(err)
+		return cfg
+	}
+	return makeConfig(cmd, viper.GetViper())
+}
+
+// MakeProfileConfig returns the config of the named profile from the
+// "profiles" section of the config file. The endpoint and credentials come
+// from the profile alone, everything else is inherited. An empty name is
+// the config of MakeConfig. A name the config file has no profile of is an
+// error.
+func MakeProfileConfig(cmd *cobra.Command, name string) (Config, error) {
+	if name == "" {
+		return MakeConfig(cmd), nil
+	}
+	return makeProfileConfig(cmd, name)
+}
+
+func makeProfileConfig(cmd *cobra.Command, name string) (Config, error) {
+	v := viper.New()
+	for key, value := range viper.AllSettings() {
+		if key != profilesKey && !endpointKeys[key] {
+			v.Set(key, value)
+		}
+	}
+	profile := viper.GetStringMap(profilesKey + "." + name)
+	if len(profile) == 0 {
+		return Config{}, fmt.Errorf("unknown profile %q, the config file has no %s.%s", name, profilesKey, name)
+	}
+	for key, value := range profile {
+		v.Set(key, value)
+	}
+	cfg := makeConfig(cmd, v)
+	cfg.Profile = name
+	return cfg, nil
+}
+
+func makeConfig(cmd *cobra.Command, v *viper.Viper) Config {
 	var cfg Config
-	err := viper.Unmarshal(&cfg)
+	err := v.Unmarshal(&cfg, decodeHook())
 	if err != nil && tool.IsDebug(cmd) {
 		slog.Error("Error binding flag", "error", err)
 	}
@@ -41,28 +169,33 @@ func MakeConfig(cmd *cobra.Command) Config {
 		if err != nil && tool.IsDebug(cmd) {
 			slog.Error("Error binding flag", "error", err)
 		}
-		if u != nil && cfg.Address == "" {
-			cfg.Address = u.Host
-		}
-		if u != nil && u.Scheme == "http" {
-			if !strings.Contains(cfg.Address, ":") {
-				cfg.Address = cfg.Address + ":80"
-			}
+		if u != nil {
+			cfg.applyEndpoint(u)
 		}
 		if u != nil && u.Scheme == "https" {
-			cfg.ssl = true
-			if !strings.Contains(cfg.Address, ":") {
-				cfg.Address = cfg.Address + ":443"
-			}
 			//goland:noinspection HttpUrlsUsage
-			cfg.S3Host = "http://" + u.Host
+			cfg.S3Host = "http://" + u.Host + strings.TrimSuffix(u.Path, "/")
 		}
-		if u != nil && cfg.ServerName == "" && len(u.Host) > 0 {
-			a := strings.Split(u.Host, ":")
-			if len(a) > 0 {
-				cfg.ServerName = a[0]
-			}
+	} else if cfg.URL != "" {
+		var u *url.URL
+		u, err = url.Parse(cfg.URL)
+		if err != nil && tool.IsDebug(cmd) {
+			slog.Error("Error binding flag", "error", err)
 		}
+		if u != nil {
+			cfg.applyEndpoint(u)
+		}
+	}
+	switch cfg.Addressing {
+	case AddressingAuto, AddressingPath, AddressingVirtual:
+	case "":
+		cfg.Addressing = AddressingPath
+	default:
+		slog.Error("Unknown addressing, using path-style", "addressing", cfg.Addressing)
+		cfg.Addressing = AddressingPath
+	}
+	if cfg.Addressing == AddressingVirtual && strings.Contains(strings.TrimPrefix(cfg.S3Host, "http://"), "/") {
+		slog.Warn("Virtual-hosted addressing keeps the bucket in the base path", "s3_host", cfg.S3Host)
 	}
 	if tool.IsDebug(cmd) {
 		slog.Debug("variable:", "config", fmt.Sprintf("%+v", cfg))
@@ -70,6 +203,31 @@ func MakeConfig(cmd *cobra.Command) Config {
 	return cfg
 }
 
+// applyEndpoint derives the dial address, TLS and SNI from the endpoint URL
+// unless they were set explicitly.
+func (c *Config) applyEndpoint(u *url.URL) {
+	if c.Address == "" {
+		c.Address = u.Host
+	}
+	if u.Scheme == "http" {
+		if !strings.Contains(c.Address, ":") {
+			c.Address = c.Address + ":80"
+		}
+	}
+	if u.Scheme == "https" {
+		c.ssl = true
+		if !strings.Contains(c.Address, ":") {
+			c.Address = c.Address + ":443"
+		}
+	}
+	if c.ServerName == "" && len(u.Host) > 0 {
+		a := strings.Split(u.Host, ":")
+		if len(a) > 0 {
+			c.ServerName = a[0]
+		}
+	}
+}
+
 func (c Config) Ssl() bool {
 	return c.ssl
 }
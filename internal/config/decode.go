@@ -0,0 +1,32 @@
+package config
+
+import (
+	"reflect"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+// ByteSize is a setting in bytes, read from counts such as 10GiB; other
+// int64 settings, a seed, are plain numbers.
+type ByteSize int64
+
+// decodeHook is the default decode hook of viper that also reads byte
+// counts such as 10GiB into the ByteSize fields.
+func decodeHook() viper.DecoderConfigOption {
+	return viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		stringToByteSizeHook,
+	))
+}
+
+func stringToByteSizeHook(from, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || to != reflect.TypeOf(ByteSize(0)) {
+		return data, nil
+	}
+	n, err := tool.ParseByteSize(data.(string))
+	return ByteSize(n), err
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+// EnvPrefix is prepended to the environment variable of every setting,
+// so that generic names like KEY or SIZE do not leak into the tool.
+const EnvPrefix = "AWSFILES"
+
+// standardEnv lists the well-known AWS variables recognized after the
+// prefixed one, in order of precedence.
+var standardEnv = map[string][]string{
+	"access_key_id":     {"AWS_ACCESS_KEY_ID"},
+	"secret_access_key": {"AWS_SECRET_ACCESS_KEY"},
+	"session_token":     {"AWS_SESSION_TOKEN"},
+	"s3_host":           {"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"},
+}
+
+// EnvNames returns the environment variables consulted for the flag.
+func EnvNames(flag string) []string {
+	key := tool.KebabCaseToSnakeCase(flag)
+	return append([]string{tool.KebabCaseToEnvVar(EnvPrefix, flag)}, standardEnv[key]...)
+}
+
+// BindEnv binds the flag's setting to its environment variables.
+func BindEnv(flag string) error {
+	return viper.BindEnv(append([]string{tool.KebabCaseToSnakeCase(flag)}, EnvNames(flag)...)...)
+}
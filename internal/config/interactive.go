@@ -0,0 +1,88 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// prompted are the settings asked for by WriteInteractive.
+var prompted = []string{
+	"s3_host",
+	"region",
+	"access_key_id",
+	"secret_access_key",
+	"bucket",
+	"ca_file",
+	"server_name",
+	"insecure_skip_verify",
+}
+
+// WriteInteractive asks for the main settings on in, offering the current
+// values as defaults, and writes the answers to the YAML file at path.
+// An existing file is only replaced when force is set.
+func WriteInteractive(in io.Reader, out io.Writer, path string, current Config, force bool) error {
+	scanner := bufio.NewScanner(in)
+	settings := current.Settings()
+	types := settingTypes()
+	v := viper.New()
+	for _, key := range prompted {
+		def := settings[key]
+		if _, err := fmt.Fprintf(out, "%s [%v]: ", key, RedactValue(key, def)); err != nil {
+			return err
+		}
+		answer := ""
+		if scanner.Scan() {
+			answer = strings.TrimSpace(scanner.Text())
+		} else if err := scanner.Err(); err != nil {
+			return err
+		}
+		value, err := parseAnswer(types[key], answer, def)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if !reflect.ValueOf(value).IsZero() {
+			v.Set(key, value)
+		}
+	}
+	v.SetConfigType("yaml")
+	if force {
+		return v.WriteConfigAs(path)
+	}
+	return v.SafeWriteConfigAs(path)
+}
+
+func parseAnswer(kind reflect.Kind, answer string, def any) (any, error) {
+	if answer == "" {
+		return def, nil
+	}
+	switch kind {
+	case reflect.Bool:
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		return strconv.ParseBool(answer)
+	case reflect.Int:
+		return strconv.Atoi(answer)
+	}
+	return answer, nil
+}
+
+func settingTypes() map[string]reflect.Kind {
+	result := make(map[string]reflect.Kind)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("mapstructure"); tag != "" && tag != "-" {
+			result[tag] = t.Field(i).Type.Kind()
+		}
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+const redacted = "********"
+
+// secretKeys are never printed in clear text.
+var secretKeys = map[string]bool{
+	"secret_access_key": true,
+	"session_token":     true,
+	"sse_customer_key":  true,
+}
+
+// Keys returns the settings known to Config in declaration order.
+func Keys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("mapstructure"); tag != "" && tag != "-" {
+			keys = append(keys, tag)
+		}
+	}
+	return keys
+}
+
+// IsSecret reports whether the setting holds a credential.
+func IsSecret(key string) bool {
+	return secretKeys[key]
+}
+
+// Settings returns the config as a map keyed by setting name.
+func (c Config) Settings() map[string]any {
+	result := make(map[string]any)
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("mapstructure"); tag != "" && tag != "-" {
+			result[tag] = v.Field(i).Interface()
+		}
+	}
+	return result
+}
+
+// Redacted returns the settings with credentials masked.
+func (c Config) Redacted() map[string]any {
+	result := c.Settings()
+	for key, value := range result {
+		result[key] = RedactValue(key, value)
+	}
+	return result
+}
+
+// RedactValue masks the value of a secret setting, and all but the last
+// four characters of the access key id.
+func RedactValue(key string, value any) any {
+	s, ok := value.(string)
+	switch {
+	case !ok || s == "":
+		return value
+	case IsSecret(key):
+		return redacted
+	case key == "access_key_id" && len(s) > 4:
+		return strings.Repeat("*", len(s)-4) + s[len(s)-4:]
+	}
+	return value
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+	"github.com/vskurikhin/awsfiles/internal/datagen"
+	"github.com/vskurikhin/awsfiles/internal/sizedist"
+)
+
+// Validate checks the config file against the Config schema: unknown keys,
+// values of the wrong type and settings that can not work are reported.
+func Validate(path string) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	var errs []error
+	known := make(map[string]bool)
+	for _, key := range Keys() {
+		known[key] = true
+	}
+	for _, key := range v.AllKeys() {
+		name := key
+		if parts := strings.SplitN(key, ".", 3); len(parts) == 3 && parts[0] == profilesKey {
+			name = parts[2]
+		}
+		if !known[name] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting", key))
+		}
+	}
+	var cfg Config
+	if err := v.Unmarshal(&cfg, decodeHook()); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	if cfg.S3Host != "" {
+		u, err := url.Parse(cfg.S3Host)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("s3_host: %w", err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("s3_host: scheme must be http or https, got %q", u.Scheme))
+		}
+	}
+	switch cfg.Addressing {
+	case "", AddressingAuto, AddressingPath, AddressingVirtual:
+	default:
+		errs = append(errs, fmt.Errorf("addressing: must be path, virtual or auto, got %q", cfg.Addressing))
+	}
+	if v.IsSet("buffer_size") && cfg.BufferSize <= 0 {
+		errs = append(errs, fmt.Errorf("buffer_size: must be positive, got %d", cfg.BufferSize))
+	}
+	if v.IsSet("size") {
+		if _, err := sizedist.Parse(cfg.Size); err != nil {
+			errs = append(errs, fmt.Errorf("size: %w", err))
+		}
+	}
+	if v.IsSet("data_pattern") {
+		if _, err := datagen.Parse(cfg.DataPattern); err != nil {
+			errs = append(errs, fmt.Errorf("data_pattern: %w", err))
+		}
+	}
+	if err := checksum.Validate(cfg.Checksum); err != nil {
+		errs = append(errs, fmt.Errorf("checksum: %w", err))
+	}
+	if cfg.CAFile != "" {
+		if _, err := os.Stat(cfg.CAFile); err != nil {
+			errs = append(errs, fmt.Errorf("ca_file: %w", err))
+		}
+	}
+	if cfg.SecretAccessKey != "" && cfg.AccessKeyID == "" {
+		errs = append(errs, errors.New("access_key_id: required when secret_access_key is set"))
+	}
+	return errors.Join(errs...)
+}
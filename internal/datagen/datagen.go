@@ -0,0 +1,86 @@
+// Package datagen generates the reproducible data of upload-random and
+// verifies downloads against it.
+package datagen
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MetaGenerator and MetaSeed are the object metadata keys naming how
+	// the data was generated.
+	MetaGenerator = "awsfiles-generator"
+	MetaSeed      = "awsfiles-seed"
+)
+
+// Generator makes the reproducible data stream of a pattern.
+type Generator interface {
+	// ID names the pattern in the object metadata, so that Parse(ID())
+	// makes the same generator.
+	ID() string
+	// New returns the endless stream for the seed.
+	New(seed int64) (io.Reader, error)
+}
+
+// Parse returns the generator of a data pattern:
+//
+//	random                               ChaCha8
+//	zeros                                zero bytes
+//	compressible:<ratio>                 compressing by about the ratio
+//	dedupable:<block>,<unique-fraction>  blocks repeating but the fraction
+//	file:<path>                          the file, looped
+//	math-rand                            math/rand of older uploads
+func Parse(pattern string) (Generator, error) {
+	kind, arg, _ := strings.Cut(pattern, ":")
+	switch kind {
+	case Random:
+		return chacha{}, nil
+	case Zeros:
+		return zeros{}, nil
+	case MathRand:
+		return mathRand{}, nil
+	case Compressible:
+		return parseCompressible(arg)
+	case Dedupable:
+		return parseDedupable(arg)
+	case File:
+		if arg == "" {
+			return nil, fmt.Errorf("file: expected a path")
+		}
+		return file(arg), nil
+	}
+	return nil, fmt.Errorf("unknown data pattern %q", pattern)
+}
+
+// New returns the stream of the generator pattern for the seed.
+func New(pattern string, seed int64) (io.Reader, error) {
+	g, err := Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return g.New(seed)
+}
+
+// Metadata is the object metadata recording the generator and seed.
+func Metadata(g Generator, seed int64) map[string]string {
+	return map[string]string{
+		MetaGenerator: g.ID(),
+		MetaSeed:      strconv.FormatInt(seed, 10),
+	}
+}
+
+// FromMetadata returns the stream recorded by Metadata.
+func FromMetadata(metadata map[string]string) (io.Reader, error) {
+	generator, ok := metadata[MetaGenerator]
+	if !ok {
+		return nil, fmt.Errorf("no %s metadata, the object was not generated by upload-random", MetaGenerator)
+	}
+	seed, err := strconv.ParseInt(metadata[MetaSeed], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s metadata: %w", MetaSeed, err)
+	}
+	return New(generator, seed)
+}
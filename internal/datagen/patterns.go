@@ -0,0 +1,180 @@
+package datagen
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	mathrand "math/rand"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+// The names of the data patterns.
+const (
+	Compressible = "compressible"
+	Dedupable    = "dedupable"
+	File         = "file"
+	MathRand     = "math-rand"
+	Random       = "random"
+	Zeros        = "zeros"
+)
+
+const (
+	// compressibleBlock is the unit of which compressible fills a share
+	// with random bytes and zeroes the rest.
+	compressibleBlock = 4096
+	// dedupablePool caps the unique blocks dedupable repeats.
+	dedupablePool = 16
+)
+
+// chachaSeed puts the int64 seed in the first 8 of the 32 bytes ChaCha8
+// takes, the rest zero. Objects record only the seed, so changing this
+// changes the data of every seed uploaded before.
+func chachaSeed(seed int64) [32]byte {
+	var s [32]byte
+	binary.LittleEndian.PutUint64(s[:], uint64(seed))
+	return s
+}
+
+type chacha struct{}
+
+func (chacha) ID() string { return Random }
+
+func (chacha) New(seed int64) (io.Reader, error) {
+	return rand.NewChaCha8(chachaSeed(seed)), nil
+}
+
+type mathRand struct{}
+
+func (mathRand) ID() string { return MathRand }
+
+func (mathRand) New(seed int64) (io.Reader, error) {
+	return mathrand.New(mathrand.NewSource(seed)), nil
+}
+
+type zeros struct{}
+
+func (zeros) ID() string { return Zeros }
+
+func (zeros) New(int64) (io.Reader, error) { return zeroReader{}, nil }
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// blockReader streams the blocks fill generates one after another.
+type blockReader struct {
+	block []byte
+	off   int
+	fill  func(block []byte)
+}
+
+func newBlockReader(size int, fill func(block []byte)) *blockReader {
+	return &blockReader{block: make([]byte, size), off: size, fill: fill}
+}
+
+func (b *blockReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if b.off == len(b.block) {
+			b.fill(b.block)
+			b.off = 0
+		}
+		c := copy(p[n:], b.block[b.off:])
+		b.off += c
+		n += c
+	}
+	return n, nil
+}
+
+// compressible fills 1/ratio of every block with random bytes.
+type compressible float64
+
+func parseCompressible(arg string) (Generator, error) {
+	ratio, err := strconv.ParseFloat(arg, 64)
+	if err != nil || ratio < 1 || math.IsInf(ratio, 0) {
+		return nil, fmt.Errorf("compressible: expected a ratio of at least 1, got %q", arg)
+	}
+	return compressible(ratio), nil
+}
+
+func (c compressible) ID() string {
+	return Compressible + ":" + strconv.FormatFloat(float64(c), 'f', -1, 64)
+}
+
+func (c compressible) New(seed int64) (io.Reader, error) {
+	random := rand.NewChaCha8(chachaSeed(seed))
+	share := int(math.Ceil(compressibleBlock / float64(c)))
+	return newBlockReader(compressibleBlock, func(block []byte) {
+		_, _ = random.Read(block[:share])
+		clear(block[share:])
+	}), nil
+}
+
+// dedupable repeats earlier blocks, all but the unique fraction.
+type dedupable struct {
+	block  int64
+	unique float64
+}
+
+func parseDedupable(arg string) (Generator, error) {
+	b, f, ok := strings.Cut(arg, ",")
+	if !ok {
+		return nil, fmt.Errorf("dedupable: expected <block>,<unique-fraction>, got %q", arg)
+	}
+	block, err := tool.ParseByteSize(b)
+	if err != nil || block <= 0 || block > math.MaxInt32 {
+		return nil, fmt.Errorf("dedupable: invalid block size %q", b)
+	}
+	unique, err := strconv.ParseFloat(f, 64)
+	if err != nil || unique < 0 || unique > 1 {
+		return nil, fmt.Errorf("dedupable: expected a unique fraction in [0, 1], got %q", f)
+	}
+	return dedupable{block: block, unique: unique}, nil
+}
+
+func (d dedupable) ID() string {
+	return fmt.Sprintf("%s:%d,%s", Dedupable, d.block, strconv.FormatFloat(d.unique, 'f', -1, 64))
+}
+
+func (d dedupable) New(seed int64) (io.Reader, error) {
+	random := rand.NewChaCha8(chachaSeed(seed))
+	choice := rand.New(rand.NewPCG(uint64(seed), 0))
+	var pool [][]byte
+	return newBlockReader(int(d.block), func(block []byte) {
+		if len(pool) == 0 || choice.Float64() < d.unique {
+			_, _ = random.Read(block)
+			if len(pool) < dedupablePool {
+				pool = append(pool, append([]byte(nil), block...))
+			}
+			return
+		}
+		copy(block, pool[choice.IntN(len(pool))])
+	}), nil
+}
+
+// file loops the content of the file, the same for every seed.
+type file string
+
+func (f file) ID() string { return File + ":" + string(f) }
+
+func (f file) New(int64) (io.Reader, error) {
+	b, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("file: %s is empty", string(f))
+	}
+	return newBlockReader(len(b), func(block []byte) {
+		copy(block, b)
+	}), nil
+}
@@ -0,0 +1,75 @@
+package datagen
+
+import (
+	"fmt"
+	"io"
+)
+
+// Verifier is an io.Writer comparing what is written with the expected
+// stream, remembering the first byte that differs.
+type Verifier struct {
+	expected io.Reader
+	buf      []byte
+	n        int64
+	first    int64
+	want     byte
+	got      byte
+	differ   int64
+	// extra counts the bytes written past the end of the expected stream,
+	// err is why it ended early when not at EOF.
+	extra int64
+	err   error
+}
+
+var _ io.Writer = (*Verifier)(nil)
+
+func NewVerifier(expected io.Reader) *Verifier {
+	return &Verifier{expected: expected, first: -1}
+}
+
+// Write never fails, so that the whole body is still read and hashed; the
+// bytes past the end of the expected stream are counted for Err.
+func (v *Verifier) Write(p []byte) (int, error) {
+	if cap(v.buf) < len(p) {
+		v.buf = make([]byte, len(p))
+	}
+	want := v.buf[:len(p)]
+	m := 0
+	if v.extra == 0 && v.err == nil {
+		var err error
+		m, err = io.ReadFull(v.expected, want)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			v.err = err
+		}
+	}
+	v.extra += int64(len(p) - m)
+	for i := range p[:m] {
+		if p[i] != want[i] {
+			if v.first < 0 {
+				v.first, v.want, v.got = v.n+int64(i), want[i], p[i]
+			}
+			v.differ++
+		}
+	}
+	v.n += int64(len(p))
+	return len(p), nil
+}
+
+// Err describes the first mismatch, or a length other than size, and is
+// nil when the data is as generated.
+func (v *Verifier) Err(size int64) error {
+	if v.first >= 0 {
+		return fmt.Errorf("first mismatch at byte offset %d: expected 0x%02x, got 0x%02x (%d of %d bytes differ)",
+			v.first, v.want, v.got, v.differ, v.n)
+	}
+	if v.err != nil {
+		return fmt.Errorf("generating the expected data failed after %d bytes: %w", v.n-v.extra, v.err)
+	}
+	if v.extra > 0 {
+		return fmt.Errorf("read %d bytes, %d past the %d generated", v.n, v.extra, v.n-v.extra)
+	}
+	if v.n != size {
+		return fmt.Errorf("read %d bytes, expected %d", v.n, size)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package etag
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const mib = 1024 * 1024
+
+// commonPartSizes are the part sizes tried when the one an object was
+// uploaded with is unknown: this tool, the AWS CLI and common SDK defaults.
+var commonPartSizes = []int64{5 * mib, 8 * mib, 16 * mib, 64 * mib, 100 * mib}
+
+// Compute returns the ETag S3 assigns to the data uploaded in parts of
+// partSize: the plain MD5 for a single part, md5(md5s)-N otherwise.
+func Compute(r io.Reader, partSize int64) (string, error) {
+	w := NewWriter(partSize)
+	if _, err := io.Copy(w, r); err != nil {
+		return "", err
+	}
+	return w.ETag(), nil
+}
+
+// Writer computes the ETag of what is written to it, like Compute.
+type Writer struct {
+	partSize int64
+	part     hash.Hash
+	n        int64 // bytes in part
+	sums     []byte
+	whole    hash.Hash
+}
+
+var _ io.Writer = (*Writer)(nil)
+
+func NewWriter(partSize int64) *Writer {
+	return &Writer{partSize: partSize, part: md5.New(), whole: md5.New()}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	written := len(p)
+	w.whole.Write(p)
+	for len(p) > 0 {
+		if w.n == w.partSize {
+			w.sums = w.part.Sum(w.sums)
+			w.part.Reset()
+			w.n = 0
+		}
+		c := min(int64(len(p)), w.partSize-w.n)
+		w.part.Write(p[:c])
+		w.n += c
+		p = p[c:]
+	}
+	return written, nil
+}
+
+// PartSize is the part size of the Writer.
+func (w *Writer) PartSize() int64 {
+	return w.partSize
+}
+
+// ETag returns the ETag of the data written so far.
+func (w *Writer) ETag() string {
+	sums := w.part.Sum(append([]byte(nil), w.sums...))
+	if len(sums) == md5.Size {
+		return hex.EncodeToString(w.whole.Sum(nil))
+	}
+	return Combine(sums, len(sums)/md5.Size)
+}
+
+// Matches reports whether the server ETag is that of the data written,
+// which a multipart upload of a single part gives as md5(md5)-1.
+func (w *Writer) Matches(etag string) bool {
+	etag = Trim(etag)
+	if etag == w.ETag() {
+		return true
+	}
+	sums := w.part.Sum(append([]byte(nil), w.sums...))
+	return etag == Combine(sums, len(sums)/md5.Size)
+}
+
+// Combine builds the multipart ETag from the concatenated binary MD5s of
+// the parts.
+func Combine(sums []byte, parts int) string {
+	sum := md5.Sum(sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts)
+}
+
+// Parts returns the number of parts encoded in a multipart ETag, 1 for a
+// plain MD5 ETag.
+func Parts(etag string) int {
+	_, suffix, ok := strings.Cut(Trim(etag), "-")
+	if !ok {
+		return 1
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Trim removes the quotes S3 puts around ETags.
+func Trim(etag string) string {
+	return strings.Trim(etag, `"`)
+}
+
+// PartSizes returns the candidate part sizes that split size bytes into
+// exactly parts parts, preferring the explicit partSize when given.
+func PartSizes(size int64, parts int, partSize int64) []int64 {
+	candidates := append([]int64{}, commonPartSizes...)
+	if parts > 1 {
+		exact := (size + int64(parts) - 1) / int64(parts)
+		candidates = append(candidates, (exact+mib-1)/mib*mib)
+	}
+	if partSize > 0 {
+		candidates = append([]int64{partSize}, candidates...)
+	}
+	var result []int64
+	for _, c := range candidates {
+		if c > 0 && partCount(size, c) == parts {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// MatchesFile reports whether the local file has the given ETag, trying
+// the plausible part sizes of a multipart ETag.
+func MatchesFile(path, etag string, size, partSize int64) (bool, error) {
+	etag = Trim(etag)
+	parts := Parts(etag)
+	sizes := []int64{size + 1}
+	if parts > 1 {
+		sizes = PartSizes(size, parts, partSize)
+	}
+	for _, ps := range sizes {
+		local, err := computeFile(path, ps)
+		if err != nil {
+			return false, err
+		}
+		if local == etag {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func computeFile(path string, partSize int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	return Compute(f, partSize)
+}
+
+func partCount(size, partSize int64) int {
+	if size == 0 {
+		return 1
+	}
+	return int((size + partSize - 1) / partSize)
+}
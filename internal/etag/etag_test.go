@@ -0,0 +1,123 @@
+package etag
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// multipartETag is the ETag S3 gives data uploaded in parts of partSize.
+func multipartETag(data []byte, partSize int) string {
+	var sums []byte
+	for len(data) > 0 {
+		n := min(partSize, len(data))
+		sum := md5.Sum(data[:n])
+		sums = append(sums, sum[:]...)
+		data = data[n:]
+	}
+	return Combine(sums, len(sums)/md5.Size)
+}
+
+func TestWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64) // 1 KiB
+	whole := md5.Sum(data)
+	tests := []struct {
+		name     string
+		partSize int64
+		want     string
+	}{
+		{"single part", 4096, hex.EncodeToString(whole[:])},
+		{"exactly one part", 1024, hex.EncodeToString(whole[:])},
+		{"even parts", 256, multipartETag(data, 256)},
+		{"short last part", 300, multipartETag(data, 300)},
+		{"byte parts", 1, multipartETag(data, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Writes of odd sizes cross the part boundaries.
+			w := NewWriter(tt.partSize)
+			for p := data; len(p) > 0; {
+				n := min(len(p), 7)
+				if _, err := w.Write(p[:n]); err != nil {
+					t.Fatal(err)
+				}
+				p = p[n:]
+			}
+			if got := w.ETag(); got != tt.want {
+				t.Errorf("ETag() = %q, want %q", got, tt.want)
+			}
+			if !w.Matches(`"` + tt.want + `"`) {
+				t.Errorf("Matches(%q) = false", tt.want)
+			}
+			got, err := Compute(bytes.NewReader(data), tt.partSize)
+			if err != nil || got != tt.want {
+				t.Errorf("Compute() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriterSinglePartUpload(t *testing.T) {
+	data := []byte("a part of its own")
+	w := NewWriter(1024)
+	_, _ = w.Write(data)
+	// A multipart upload of a single part has the ETag md5(md5)-1.
+	if etag := multipartETag(data, 1024); !w.Matches(etag) {
+		t.Errorf("Matches(%q) = false", etag)
+	}
+	if w.Matches("0123456789abcdef0123456789abcdef") {
+		t.Error("Matches of another MD5 = true")
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	if got, want := NewWriter(5*mib).ETag(), "d41d8cd98f00b204e9800998ecf8427e"; got != want {
+		t.Errorf("ETag() of no data = %q, want %q", got, want)
+	}
+}
+
+func TestParts(t *testing.T) {
+	tests := []struct {
+		etag string
+		want int
+	}{
+		{`"d41d8cd98f00b204e9800998ecf8427e"`, 1},
+		{"d41d8cd98f00b204e9800998ecf8427e-12", 12},
+		{`"d41d8cd98f00b204e9800998ecf8427e-3"`, 3},
+		{"d41d8cd98f00b204e9800998ecf8427e-x", 0},
+	}
+	for _, tt := range tests {
+		if got := Parts(tt.etag); got != tt.want {
+			t.Errorf("Parts(%q) = %d, want %d", tt.etag, got, tt.want)
+		}
+	}
+}
+
+func TestPartSizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		parts    int
+		partSize int64
+		want     []int64
+	}{
+		{"one part", 3 * mib, 1, 0, []int64{5 * mib, 8 * mib, 16 * mib, 64 * mib, 100 * mib}},
+		{"common sizes", 20 * mib, 4, 0, []int64{5 * mib, 5 * mib}},
+		{"several common sizes", 33 * mib, 3, 0, []int64{16 * mib, 11 * mib}},
+		{"exact size", 30 * mib, 2, 0, []int64{16 * mib, 15 * mib}},
+		{"uncommon size", 70 * mib, 7, 0, []int64{10 * mib}},
+		{"explicit size first", 30 * mib, 3, 10 * mib, []int64{10 * mib, 10 * mib}},
+		{"explicit size off", 30 * mib, 2, 10 * mib, []int64{16 * mib, 15 * mib}},
+		{"empty object", 0, 1, 0, []int64{5 * mib, 8 * mib, 16 * mib, 64 * mib, 100 * mib}},
+		{"too many parts", 6 * mib, 10, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PartSizes(tt.size, tt.parts, tt.partSize); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PartSizes(%d, %d, %d) = %v, want %v", tt.size, tt.parts, tt.partSize, got, tt.want)
+			}
+		})
+	}
+}
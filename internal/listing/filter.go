@@ -0,0 +1,85 @@
+package listing
+
+import (
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+// Filter selects objects by key pattern, size and modification time.
+// Glob patterns match either the full key or its base name.
+type Filter struct {
+	Include   []string
+	Exclude   []string
+	Regex     *regexp.Regexp
+	MinSize   int64
+	MaxSize   int64
+	NewerThan time.Duration
+	OlderThan time.Duration
+	now       time.Time
+}
+
+func MakeFilter(cfg config.Config) (Filter, error) {
+	f := Filter{
+		Include:   cfg.Include,
+		Exclude:   cfg.Exclude,
+		MinSize:   int64(cfg.MinSize),
+		MaxSize:   int64(cfg.MaxSize),
+		NewerThan: cfg.NewerThan,
+		OlderThan: cfg.OlderThan,
+		now:       time.Now(),
+	}
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return f, err
+		}
+	}
+	if cfg.Regex != "" {
+		re, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return f, err
+		}
+		f.Regex = re
+	}
+	return f, nil
+}
+
+func (f Filter) Match(e Entry) bool {
+	key := e.Key
+	if len(f.Include) > 0 && !matchAny(f.Include, key) {
+		return false
+	}
+	if matchAny(f.Exclude, key) {
+		return false
+	}
+	if f.Regex != nil && !f.Regex.MatchString(key) {
+		return false
+	}
+	if e.Size < f.MinSize || (f.MaxSize > 0 && e.Size > f.MaxSize) {
+		return false
+	}
+	if e.LastModified != nil {
+		age := f.now.Sub(*e.LastModified)
+		if f.NewerThan > 0 && age > f.NewerThan {
+			return false
+		}
+		if f.OlderThan > 0 && age < f.OlderThan {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(key)); ok {
+			return true
+		}
+	}
+	return false
+}
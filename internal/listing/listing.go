@@ -0,0 +1,170 @@
+package listing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+const (
+	delimiter   = "/"
+	maxPageKeys = 1000
+	timeLayout  = "2006-01-02 15:04:05"
+)
+
+// Entry is an object or, in delimiter mode, a common prefix.
+type Entry struct {
+	Key          string     `json:"key"`
+	Prefix       bool       `json:"prefix,omitempty"`
+	Size         int64      `json:"size"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+	ETag         string     `json:"etag,omitempty"`
+	StorageClass string     `json:"storage_class,omitempty"`
+}
+
+// List prints the objects under s3://bucket/prefix, or the buckets when
+// bucket is empty.
+func List(cfg config.Config, bucket, prefix string) {
+	ctx := context.Background()
+	s3Client := client.New(cfg)
+	if bucket == "" {
+		listBuckets(ctx, cfg, s3Client)
+		return
+	}
+	filter, err := MakeFilter(cfg)
+	if err != nil {
+		slog.Error("List failed", "err", err)
+		return
+	}
+	p := newPrinter(cfg.Format)
+	count := 0
+	err = Walk(ctx, s3Client, bucket, prefix, cfg.Recursive, func(e Entry) bool {
+		if e.Prefix || filter.Match(e) {
+			p.print(e)
+			count++
+		}
+		return cfg.MaxKeys <= 0 || count < cfg.MaxKeys
+	})
+	p.flush()
+	if err != nil {
+		slog.Error("List failed", "err", err)
+	}
+}
+
+// Walk pages through ListObjectsV2 and calls fn for every entry until fn
+// returns false. Without recursive the listing stops at the next "/".
+func Walk(ctx context.Context, s3Client *s3.Client, bucket, prefix string, recursive bool, fn func(Entry) bool) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		MaxKeys: maxPageKeys,
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	if !recursive {
+		input.Delimiter = aws.String(delimiter)
+	}
+	paginator := s3.NewListObjectsV2Paginator(s3Client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, p := range page.CommonPrefixes {
+			if !fn(Entry{Key: aws.ToString(p.Prefix), Prefix: true}) {
+				return nil
+			}
+		}
+		for _, obj := range page.Contents {
+			if !fn(makeEntry(obj)) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func makeEntry(obj types.Object) Entry {
+	return Entry{
+		Key:          aws.ToString(obj.Key),
+		Size:         obj.Size,
+		LastModified: obj.LastModified,
+		ETag:         strings.Trim(aws.ToString(obj.ETag), `"`),
+		StorageClass: string(obj.StorageClass),
+	}
+}
+
+func listBuckets(ctx context.Context, cfg config.Config, s3Client *s3.Client) {
+	out, err := s3Client.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		slog.Error("List buckets failed", "err", err)
+		return
+	}
+	p := newPrinter(cfg.Format)
+	for _, b := range out.Buckets {
+		p.printBucket(b)
+	}
+	p.flush()
+}
+
+type printer struct {
+	format string
+	tw     *tabwriter.Writer
+	enc    *json.Encoder
+}
+
+func newPrinter(format string) *printer {
+	return &printer{
+		format: format,
+		tw:     tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0),
+		enc:    json.NewEncoder(os.Stdout),
+	}
+}
+
+func (p *printer) print(e Entry) {
+	mtime := ""
+	if e.LastModified != nil {
+		mtime = e.LastModified.Local().Format(timeLayout)
+	}
+	switch {
+	case p.format == config.FormatJSON:
+		_ = p.enc.Encode(e)
+	case e.Prefix:
+		_, _ = fmt.Fprintf(p.tw, "\tPRE\t%s\n", e.Key)
+	case p.format == config.FormatLong:
+		_, _ = fmt.Fprintf(p.tw, "%s\t%d\t%s\t%s\t%s\n", mtime, e.Size, e.ETag, e.StorageClass, e.Key)
+	default:
+		_, _ = fmt.Fprintf(p.tw, "%s\t%d\t%s\n", mtime, e.Size, e.Key)
+	}
+}
+
+func (p *printer) printBucket(b types.Bucket) {
+	if p.format == config.FormatJSON {
+		_ = p.enc.Encode(struct {
+			Name         string     `json:"name"`
+			CreationDate *time.Time `json:"creation_date,omitempty"`
+		}{aws.ToString(b.Name), b.CreationDate})
+		return
+	}
+	ctime := ""
+	if b.CreationDate != nil {
+		ctime = b.CreationDate.Local().Format(timeLayout)
+	}
+	_, _ = fmt.Fprintf(p.tw, "%s\t%s\n", ctime, aws.ToString(b.Name))
+}
+
+func (p *printer) flush() {
+	_ = p.tw.Flush()
+}
@@ -0,0 +1,137 @@
+package manifest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+)
+
+// Manifest records the checksums of the objects under a prefix.
+type Manifest struct {
+	Bucket    string    `json:"bucket,omitempty"`
+	Prefix    string    `json:"prefix,omitempty"`
+	Algorithm string    `json:"algorithm"`
+	Created   time.Time `json:"created"`
+	Objects   []Entry   `json:"objects"`
+}
+
+// Entry is an object of the manifest. Name is the key relative to the
+// directory of the prefix, the way md5sum names files.
+type Entry struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	ETag string `json:"etag,omitempty"`
+	Hash string `json:"hash"`
+}
+
+// hexLengths guess the algorithm of a text manifest from the length of
+// its checksums; crc32c shares its length with crc32 and must be named.
+var hexLengths = map[int]string{
+	8:   checksum.CRC32,
+	16:  checksum.CRC64NVME,
+	32:  checksum.MD5,
+	40:  checksum.SHA1,
+	64:  checksum.SHA256,
+	128: checksum.SHA512,
+}
+
+// writeText writes the md5sum format, "<hash>  <name>", escaping names
+// with a backslash or newline the way md5sum does.
+func writeText(w io.Writer, m Manifest) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range m.Objects {
+		name, escaped := escape(e.Name)
+		if escaped {
+			_, _ = bw.WriteString(`\`)
+		}
+		if _, err := fmt.Fprintf(bw, "%s  %s\n", e.Hash, name); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func writeJSON(w io.Writer, m Manifest) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// read parses a JSON manifest or, when the data does not start with '{',
+// the md5sum format of the algorithm, guessed when empty.
+func read(r io.Reader, algorithm string) (Manifest, error) {
+	br := bufio.NewReader(r)
+	if first, err := br.Peek(1); err == nil && first[0] == '{' {
+		var m Manifest
+		if err = json.NewDecoder(br).Decode(&m); err != nil {
+			return m, err
+		}
+		if algorithm != "" && algorithm != m.Algorithm {
+			return m, fmt.Errorf("the manifest has %s checksums, not %s", m.Algorithm, algorithm)
+		}
+		return m, checksum.Validate([]string{m.Algorithm})
+	}
+	m := Manifest{Algorithm: algorithm}
+	scanner := bufio.NewScanner(br)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		e, err := parseLine(text)
+		if err != nil {
+			return m, fmt.Errorf("line %d: %w", line, err)
+		}
+		if m.Algorithm == "" {
+			if m.Algorithm = hexLengths[len(e.Hash)]; m.Algorithm == "" {
+				return m, fmt.Errorf("line %d: no checksum is %d hex digits long", line, len(e.Hash))
+			}
+		}
+		m.Objects = append(m.Objects, e)
+	}
+	return m, scanner.Err()
+}
+
+// parseLine reads "<hash>  <name>" or the binary mode "<hash> *<name>".
+func parseLine(line string) (Entry, error) {
+	escaped := strings.HasPrefix(line, `\`)
+	if escaped {
+		line = line[1:]
+	}
+	hash, name, ok := strings.Cut(line, " ")
+	if !ok || len(name) < 2 || (name[0] != ' ' && name[0] != '*') {
+		return Entry{}, fmt.Errorf("expected <hash>  <name>")
+	}
+	name = name[1:]
+	if escaped {
+		name = unescape(name)
+	}
+	return Entry{Name: name, Hash: strings.ToLower(hash)}, nil
+}
+
+func escape(name string) (string, bool) {
+	if !strings.ContainsAny(name, "\\\n") {
+		return name, false
+	}
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(name), true
+}
+
+func unescape(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+1 < len(name) {
+			i++
+			if name[i] == 'n' {
+				b.WriteByte('\n')
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
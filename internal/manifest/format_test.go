@@ -0,0 +1,127 @@
+package manifest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		escaped bool
+	}{
+		{"plain.txt", "plain.txt", false},
+		{"dir/with space.bin", "dir/with space.bin", false},
+		{`back\slash`, `back\\slash`, true},
+		{"new\nline", `new\nline`, true},
+		{"both\\\n", `both\\\n`, true},
+	}
+	for _, tt := range tests {
+		got, escaped := escape(tt.name)
+		if got != tt.want || escaped != tt.escaped {
+			t.Errorf("escape(%q) = %q, %v, want %q, %v", tt.name, got, escaped, tt.want, tt.escaped)
+		}
+		if back := unescape(got); escaped && back != tt.name {
+			t.Errorf("unescape(%q) = %q, want %q", got, back, tt.name)
+		}
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Entry
+		wantErr bool
+	}{
+		{line: "d41d8cd98f00b204e9800998ecf8427e  a.txt", want: Entry{Name: "a.txt", Hash: "d41d8cd98f00b204e9800998ecf8427e"}},
+		{line: "D41D8CD98F00B204E9800998ECF8427E *bin/a.bin", want: Entry{Name: "bin/a.bin", Hash: "d41d8cd98f00b204e9800998ecf8427e"}},
+		{line: "abcd1234   two spaces", want: Entry{Name: " two spaces", Hash: "abcd1234"}},
+		{line: `\abcd1234  new\nline\\x`, want: Entry{Name: "new\nline\\x", Hash: "abcd1234"}},
+		{line: "abcd1234", wantErr: true},
+		{line: "abcd1234 a.txt", wantErr: true},
+		{line: "abcd1234  ", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLine(%q) error = %v, want error %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		algorithm string
+		want      Manifest
+		wantErr   bool
+	}{
+		{
+			name: "md5 guessed",
+			data: "d41d8cd98f00b204e9800998ecf8427e  a\n\n0cc175b9c0f1b6a831c399e269772661  b\n",
+			want: Manifest{Algorithm: "md5", Objects: []Entry{
+				{Name: "a", Hash: "d41d8cd98f00b204e9800998ecf8427e"},
+				{Name: "b", Hash: "0cc175b9c0f1b6a831c399e269772661"},
+			}},
+		},
+		{
+			name:      "crc32c named",
+			data:      "e3069283  a\n",
+			algorithm: "crc32c",
+			want:      Manifest{Algorithm: "crc32c", Objects: []Entry{{Name: "a", Hash: "e3069283"}}},
+		},
+		{
+			name: "sha256 guessed",
+			data: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 *a\n",
+			want: Manifest{Algorithm: "sha256", Objects: []Entry{{Name: "a", Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}}},
+		},
+		{
+			name: "json",
+			data: `{"bucket": "b", "prefix": "p/", "algorithm": "sha1", "objects": [{"name": "a", "size": 3, "hash": "a9993e364706816aba3e25717850c26c9cd0d89d"}]}`,
+			want: Manifest{Bucket: "b", Prefix: "p/", Algorithm: "sha1", Objects: []Entry{{Name: "a", Size: 3, Hash: "a9993e364706816aba3e25717850c26c9cd0d89d"}}},
+		},
+		{name: "json of another algorithm", data: `{"algorithm": "sha1", "objects": []}`, algorithm: "md5", wantErr: true},
+		{name: "json of an unknown algorithm", data: `{"algorithm": "md4", "objects": []}`, wantErr: true},
+		{name: "unknown length", data: "abc  a\n", wantErr: true},
+		{name: "bad line", data: "d41d8cd98f00b204e9800998ecf8427e  a\nnonsense\n", wantErr: true},
+		{name: "empty", data: "", want: Manifest{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := read(strings.NewReader(tt.data), tt.algorithm)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("read() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	m := Manifest{Algorithm: "md5", Objects: []Entry{
+		{Name: "plain", Hash: "d41d8cd98f00b204e9800998ecf8427e"},
+		{Name: "new\nline", Hash: "0cc175b9c0f1b6a831c399e269772661"},
+		{Name: `back\slash`, Hash: "92eb5ffee6ae2fec3ad71c777531578f"},
+	}}
+	var buf bytes.Buffer
+	if err := writeText(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := read(&buf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("read(writeText()) = %+v, want %+v", got, m)
+	}
+}
@@ -0,0 +1,234 @@
+// Package manifest writes the checksums of the objects under a prefix to
+// a manifest, md5sum compatible or JSON, and verifies the objects against
+// it.
+package manifest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/listing"
+	"github.com/vskurikhin/awsfiles/internal/object"
+)
+
+// The outcomes of verifying an object.
+const (
+	StatusOK      = "OK"
+	StatusChanged = "CHANGED"
+	StatusMissing = "MISSING"
+	StatusExtra   = "EXTRA"
+	StatusFailed  = "FAILED"
+)
+
+// errMismatch is returned when objects do not match the manifest, they
+// are reported one by one.
+var errMismatch = errors.New("objects do not match the manifest")
+
+// Create reads every object under s3://bucket/prefix passing the listing
+// filter and writes the manifest of their cfg.Algorithm checksums to
+// cfg.Output, or stdout, in cfg.Format: human for md5sum's or json.
+func Create(cfg config.Config, bucket, prefix string) error {
+	algorithm := strings.ToLower(cfg.Algorithm)
+	if algorithm == "" {
+		algorithm = checksum.MD5
+	}
+	if err := checksum.Validate([]string{algorithm}); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	s3Client := client.New(cfg)
+	entries, err := list(ctx, cfg, s3Client, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	m := Manifest{Bucket: bucket, Prefix: prefix, Algorithm: algorithm, Created: time.Now().UTC(), Objects: []Entry{}}
+	var failed int
+	hashAll(ctx, cfg, s3Client, bucket, prefix, algorithm, entries, func(e Entry, err error) {
+		if err != nil {
+			slog.Error("Manifest failed", "name", e.Name, "err", err)
+			failed++
+			return
+		}
+		m.Objects = append(m.Objects, e)
+	})
+	sort.Slice(m.Objects, func(i, j int) bool { return m.Objects[i].Name < m.Objects[j].Name })
+	if err = write(cfg, m); err != nil {
+		return err
+	}
+	slog.Info("Manifest", "result", fmt.Sprintf("objects: %d, failed: %d", len(m.Objects), failed))
+	if failed > 0 {
+		return fmt.Errorf("%d objects could not be read", failed)
+	}
+	return nil
+}
+
+// Verify reads the manifest at path and the objects under
+// s3://bucket/prefix, taken from a JSON manifest when bucket is empty, and
+// reports the objects missing, changed or not in the manifest.
+func Verify(cfg config.Config, path, bucket, prefix string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	m, err := read(f, strings.ToLower(cfg.Algorithm))
+	_ = f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if bucket == "" {
+		if bucket, prefix = m.Bucket, m.Prefix; bucket == "" {
+			return fmt.Errorf("%s names no bucket, give s3://bucket/prefix", path)
+		}
+	}
+	ctx := context.Background()
+	s3Client := client.New(cfg)
+	current, err := list(ctx, cfg, s3Client, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]Entry, len(current))
+	for _, e := range current {
+		found[e.Name] = e
+	}
+	counts := make(map[string]int)
+	report := func(name, status string, err error) {
+		counts[status]++
+		switch {
+		case err != nil:
+			slog.Error("Verify failed", "name", name, "err", err)
+			fmt.Printf("%s: %s\n", name, status)
+		case status != StatusOK || cfg.Verbose:
+			fmt.Printf("%s: %s\n", name, status)
+		}
+	}
+	expected := make(map[string]string, len(m.Objects))
+	var toHash []Entry
+	for _, e := range m.Objects {
+		expected[e.Name] = e.Hash
+		cur, ok := found[e.Name]
+		switch {
+		case !ok:
+			report(e.Name, StatusMissing, nil)
+		case e.Size != 0 && cur.Size != e.Size:
+			// A JSON manifest knows the size, no need to read the object.
+			report(e.Name, StatusChanged, nil)
+		default:
+			toHash = append(toHash, cur)
+		}
+		delete(found, e.Name)
+	}
+	hashAll(ctx, cfg, s3Client, bucket, prefix, m.Algorithm, toHash, func(e Entry, err error) {
+		switch {
+		case err != nil:
+			report(e.Name, StatusFailed, err)
+		case e.Hash != expected[e.Name]:
+			report(e.Name, StatusChanged, nil)
+		default:
+			report(e.Name, StatusOK, nil)
+		}
+	})
+	extra := make([]string, 0, len(found))
+	for name := range found {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		report(name, StatusExtra, nil)
+	}
+	slog.Info("Verify", "result", fmt.Sprintf("ok: %d, changed: %d, missing: %d, extra: %d, failed: %d",
+		counts[StatusOK], counts[StatusChanged], counts[StatusMissing], counts[StatusExtra], counts[StatusFailed]))
+	if counts[StatusOK] != len(m.Objects) || len(extra) > 0 {
+		return errMismatch
+	}
+	return nil
+}
+
+// list returns the objects under the prefix passing the listing filter,
+// named relative to the directory of the prefix.
+func list(ctx context.Context, cfg config.Config, s3Client *s3.Client, bucket, prefix string) ([]Entry, error) {
+	filter, err := listing.MakeFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+	var entries []Entry
+	err = listing.Walk(ctx, s3Client, bucket, prefix, true, func(e listing.Entry) bool {
+		if filter.Match(e) {
+			entries = append(entries, Entry{Name: strings.TrimPrefix(e.Key, dir), Size: e.Size, ETag: e.ETag})
+		}
+		return true
+	})
+	return entries, err
+}
+
+// hashAll reads the entries with cfg.Concurrency workers, passing each
+// with its checksum to done, which is called by one worker at a time.
+func hashAll(ctx context.Context, cfg config.Config, s3Client *s3.Client, bucket, prefix, algorithm string, entries []Entry, done func(Entry, error)) {
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+	// Fetch reads cfg.Bucket/cfg.Key, quietly: the workers would mix the
+	// progress lines.
+	c := cfg
+	c.Bucket, c.Checksum, c.Verbose = bucket, []string{algorithm}, false
+	c.IfMatch, c.IfNoneMatch, c.IfModifiedSince = "", "", ""
+	jobs := make(chan Entry)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < max(cfg.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				c := c
+				c.Key = dir + e.Name
+				n, sums, _, err := object.Fetch(ctx, c, s3Client)
+				if err == nil {
+					e.Size, e.Hash = n, sums.Hex(algorithm)
+				}
+				mu.Lock()
+				done(e, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, e := range entries {
+		jobs <- e
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// write writes the manifest to cfg.Output, or stdout.
+func write(cfg config.Config, m Manifest) error {
+	if cfg.Output == "" {
+		return encode(cfg, os.Stdout, m)
+	}
+	f, err := os.Create(cfg.Output)
+	if err != nil {
+		return err
+	}
+	err = encode(cfg, f, m)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func encode(cfg config.Config, w io.Writer, m Manifest) error {
+	if cfg.Format == config.FormatJSON {
+		return writeJSON(w, m)
+	}
+	return writeText(w, m)
+}
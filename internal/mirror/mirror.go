@@ -0,0 +1,265 @@
+package mirror
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/etag"
+	"github.com/vskurikhin/awsfiles/internal/listing"
+	"github.com/vskurikhin/awsfiles/internal/upload"
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+type summary struct {
+	mirrored atomic.Int64
+	skipped  atomic.Int64
+	failed   atomic.Int64
+	bytes    atomic.Int64
+}
+
+type mirror struct {
+	srcCfg, dstCfg       config.Config
+	src, dst             *s3.Client
+	srcBucket, srcPrefix string
+	dstBucket, dstPrefix string
+	state                *state
+	summary              summary
+}
+
+// Mirror streams every object under the source s3://bucket/prefix to the
+// destination, each side with the client of its own config. Metadata and
+// tags are preserved and the data is checked against the ETags of both
+// sides. Objects already recorded in cfg.StateFile with an unchanged ETag
+// are skipped.
+func Mirror(srcCfg, dstCfg config.Config, src, dst string) {
+	m := &mirror{
+		srcCfg: srcCfg,
+		dstCfg: dstCfg,
+		src:    client.New(srcCfg),
+		dst:    client.New(dstCfg),
+	}
+	var ok bool
+	if m.srcBucket, m.srcPrefix, ok = tool.ParseS3URI(src); !ok {
+		slog.Error("Mirror failed", "err", "expected s3://bucket/prefix, got "+src)
+		return
+	}
+	if m.dstBucket, m.dstPrefix, ok = tool.ParseS3URI(dst); !ok {
+		slog.Error("Mirror failed", "err", "expected s3://bucket/prefix, got "+dst)
+		return
+	}
+	filter, err := listing.MakeFilter(srcCfg)
+	if err != nil {
+		slog.Error("Mirror failed", "err", err)
+		return
+	}
+	if m.state, err = openState(srcCfg.StateFile); err != nil {
+		slog.Error("Mirror failed", "err", err)
+		return
+	}
+	defer m.state.close()
+	ctx := context.Background()
+	jobs := make(chan listing.Entry)
+	var wg sync.WaitGroup
+	for i := 0; i < max(srcCfg.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				if err := m.mirrorObject(ctx, e); err != nil {
+					slog.Error("Mirror failed", "key", e.Key, "err", err)
+					m.summary.failed.Add(1)
+				}
+			}
+		}()
+	}
+	err = listing.Walk(ctx, m.src, m.srcBucket, m.srcPrefix, true, func(e listing.Entry) bool {
+		switch {
+		case !filter.Match(e):
+		case m.state.isDone(e.Key, e.ETag):
+			m.summary.skipped.Add(1)
+		default:
+			jobs <- e
+		}
+		return true
+	})
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		slog.Error("Mirror failed", "err", err)
+	}
+	slog.Info("Mirror", "result", fmt.Sprintf("mirrored: %d, skipped: %d, failed: %d, bytes: %d",
+		m.summary.mirrored.Load(), m.summary.skipped.Load(), m.summary.failed.Load(), m.summary.bytes.Load()))
+}
+
+func (m *mirror) mirrorObject(ctx context.Context, e listing.Entry) error {
+	dstKey := m.dstPrefix + strings.TrimPrefix(e.Key, m.srcPrefix)
+	tagging, err := m.tagging(ctx, e.Key)
+	if err != nil {
+		return err
+	}
+	res, err := m.src.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(m.srcBucket),
+		Key:    aws.String(e.Key),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+	// ETags of SSE-KMS and SSE-C objects are not the MD5 of the data.
+	plain := res.ServerSideEncryption != types.ServerSideEncryptionAwsKms && res.SSECustomerAlgorithm == nil
+	var body io.Reader = res.Body
+	var writers []*etag.Writer
+	if parts := etag.Parts(e.ETag); plain && parts > 1 {
+		writers = sourceWriters(m.srcCfg, e, parts)
+		body = io.TeeReader(body, etagMultiWriter(writers))
+	}
+	result, err := upload.PutObject(ctx, m.dstCfg, m.dst, &s3.PutObjectInput{
+		Bucket:             aws.String(m.dstBucket),
+		Key:                aws.String(dstKey),
+		Body:               body,
+		CacheControl:       res.CacheControl,
+		ContentDisposition: res.ContentDisposition,
+		ContentEncoding:    res.ContentEncoding,
+		ContentLanguage:    res.ContentLanguage,
+		ContentType:        res.ContentType,
+		Expires:            res.Expires,
+		Metadata:           res.Metadata,
+		Tagging:            tagging,
+	}, res.ContentLength)
+	if err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(result.MD5)
+	if result.Bytes != e.Size {
+		return fmt.Errorf("read %d bytes of %d from the source", result.Bytes, e.Size)
+	}
+	if plain && etag.Parts(e.ETag) == 1 && e.ETag != sum {
+		return fmt.Errorf("source md5sum %s does not match ETag %s", sum, e.ETag)
+	}
+	if plain && etag.Parts(e.ETag) > 1 {
+		if err = checkSource(m.srcCfg, e, writers); err != nil {
+			return err
+		}
+	}
+	if err = m.verifyDest(ctx, dstKey, result, sum); err != nil {
+		return err
+	}
+	if m.srcCfg.Verbose {
+		fmt.Printf("mirror: s3://%s/%s to s3://%s/%s\n", m.srcBucket, e.Key, m.dstBucket, dstKey)
+	}
+	m.summary.mirrored.Add(1)
+	m.summary.bytes.Add(result.Bytes)
+	return m.state.add(record{Key: e.Key, ETag: e.ETag, MD5: sum, Size: result.Bytes})
+}
+
+// sourceWriters compute the multipart ETags of the source object for the
+// part sizes that give its parts count, --part-size first.
+func sourceWriters(cfg config.Config, e listing.Entry, parts int) []*etag.Writer {
+	var writers []*etag.Writer
+	for _, ps := range etag.PartSizes(e.Size, parts, int64(cfg.PartSize)) {
+		if !slices.ContainsFunc(writers, func(w *etag.Writer) bool { return w.PartSize() == ps }) {
+			writers = append(writers, etag.NewWriter(ps))
+		}
+	}
+	return writers
+}
+
+func etagMultiWriter(writers []*etag.Writer) io.Writer {
+	w := make([]io.Writer, 0, len(writers))
+	for _, writer := range writers {
+		w = append(w, writer)
+	}
+	return io.MultiWriter(w...)
+}
+
+// checkSource compares the multipart ETag of the source with those the
+// data has in the candidate part sizes. Those may miss the part size the
+// source was uploaded with, so only a mismatch with --part-size fails; the
+// other objects are reported unverified.
+func checkSource(cfg config.Config, e listing.Entry, writers []*etag.Writer) error {
+	if len(writers) == 0 {
+		slog.Warn("Mirror did not verify the source", "key", e.Key, "etag", e.ETag, "err", "no part size gives its parts count, pass --part-size")
+		return nil
+	}
+	candidates := make([]string, 0, len(writers))
+	for _, w := range writers {
+		if w.Matches(e.ETag) {
+			return nil
+		}
+		candidates = append(candidates, fmt.Sprintf("%s (part size %d)", w.ETag(), w.PartSize()))
+	}
+	if cfg.PartSize > 0 && writers[0].PartSize() == int64(cfg.PartSize) {
+		return fmt.Errorf("source ETag %s does not match %s", e.ETag, candidates[0])
+	}
+	slog.Warn("Mirror did not verify the source", "key", e.Key, "etag", e.ETag, "tried", strings.Join(candidates, ", "), "err", "no common part size gives its ETag, pass --part-size")
+	return nil
+}
+
+// verifyDest compares the ETag computed during the upload with the
+// destination's, or reads the object back when the destination encrypts
+// it or returns no ETag.
+func (m *mirror) verifyDest(ctx context.Context, key string, result upload.Result, sum string) error {
+	dstETag := aws.ToString(result.Output.ETag)
+	if !result.Encrypted && dstETag != "" {
+		if !result.ETag.Matches(dstETag) {
+			return fmt.Errorf("destination ETag %s does not match %s", etag.Trim(dstETag), result.ETag.ETag())
+		}
+		return nil
+	}
+	res, err := m.dst.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(m.dstBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+	h := md5.New()
+	if _, err = io.Copy(h, res.Body); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		return fmt.Errorf("destination md5sum %s does not match source %s", got, sum)
+	}
+	return nil
+}
+
+// tagging returns the tags of the source object as the query string
+// PutObject expects, nil when the backend does not support tagging.
+func (m *mirror) tagging(ctx context.Context, key string) (*string, error) {
+	out, err := m.src.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(m.srcBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var apiErr interface{ ErrorCode() string }
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotImplemented" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(out.TagSet) == 0 {
+		return nil, nil
+	}
+	values := url.Values{}
+	for _, tag := range out.TagSet {
+		values.Add(aws.ToString(tag.Key), aws.ToString(tag.Value))
+	}
+	return aws.String(values.Encode()), nil
+}
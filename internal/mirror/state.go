@@ -0,0 +1,83 @@
+package mirror
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// record is a line of the state file: an object that was mirrored and
+// verified, identified by the ETag it had on the source.
+type record struct {
+	Key  string `json:"key"`
+	ETag string `json:"etag"`
+	MD5  string `json:"md5"`
+	Size int64  `json:"size"`
+}
+
+// state is the append-only JSON lines file that lets an interrupted
+// mirror continue where it stopped.
+type state struct {
+	mu   sync.Mutex
+	done map[string]record
+	f    *os.File
+	enc  *json.Encoder
+}
+
+func openState(path string) (*state, error) {
+	s := &state{done: make(map[string]record)}
+	if path == "" {
+		return s, nil
+	}
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var r record
+			if json.Unmarshal(scanner.Bytes(), &r) == nil {
+				s.done[r.Key] = r
+			}
+		}
+		_ = f.Close()
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.f = f
+	s.enc = json.NewEncoder(f)
+	return s, nil
+}
+
+// isDone reports whether the object was mirrored with the same ETag.
+func (s *state) isDone(key, etag string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.done[key]
+	return ok && r.ETag == etag
+}
+
+func (s *state) add(r record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done[r.Key] = r
+	if s.enc == nil {
+		return nil
+	}
+	if err := s.enc.Encode(r); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *state) close() {
+	if s.f != nil {
+		_ = s.f.Close()
+	}
+}
@@ -0,0 +1,236 @@
+package multipart
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// Upload is an incomplete multipart upload.
+type Upload struct {
+	Key          string     `json:"key"`
+	UploadID     string     `json:"upload_id"`
+	Initiated    *time.Time `json:"initiated,omitempty"`
+	StorageClass string     `json:"storage_class,omitempty"`
+}
+
+// Part is an uploaded part of a multipart upload.
+type Part struct {
+	PartNumber   int32      `json:"part_number"`
+	Size         int64      `json:"size"`
+	ETag         string     `json:"etag"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+	// Checksum is the additional checksum of the part, if any.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// List prints the incomplete multipart uploads under the prefix.
+func List(cfg config.Config, bucket, prefix string) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	enc := json.NewEncoder(os.Stdout)
+	err := Walk(context.Background(), client.New(cfg), bucket, prefix, func(u Upload) error {
+		if cfg.Format == config.FormatJSON {
+			return enc.Encode(u)
+		}
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", formatTime(u.Initiated), u.UploadID, u.StorageClass, u.Key)
+		return err
+	})
+	_ = tw.Flush()
+	return err
+}
+
+// ListParts prints the parts uploaded so far.
+func ListParts(cfg config.Config, bucket, key, uploadID string) error {
+	ctx := context.Background()
+	s3Client := client.New(cfg)
+	key, err := resolveKey(ctx, s3Client, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	parts, err := Parts(ctx, s3Client, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	if cfg.Format == config.FormatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(parts)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	var total int64
+	for _, p := range parts {
+		total += p.Size
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", p.PartNumber, formatTime(p.LastModified), p.Size, p.ETag)
+	}
+	_ = tw.Flush()
+	slog.Info("List parts", "result", fmt.Sprintf("parts: %d, total bytes: %d", len(parts), total))
+	return nil
+}
+
+// Abort aborts the multipart upload, looking up its key when not given.
+func Abort(cfg config.Config, bucket, key, uploadID string) error {
+	ctx := context.Background()
+	s3Client := client.New(cfg)
+	key, err := resolveKey(ctx, s3Client, bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	if err = abort(ctx, s3Client, bucket, key, uploadID); err != nil {
+		return err
+	}
+	slog.Info("Abort", "result", fmt.Sprintf("s3://%s/%s %s", bucket, key, uploadID))
+	return nil
+}
+
+// Cleanup aborts the multipart uploads under the prefix initiated longer
+// ago than cfg.OlderThan.
+func Cleanup(cfg config.Config, bucket, prefix string) error {
+	ctx := context.Background()
+	s3Client := client.New(cfg)
+	deadline := time.Now().Add(-cfg.OlderThan)
+	var aborted, failed int
+	err := Walk(ctx, s3Client, bucket, prefix, func(u Upload) error {
+		if u.Initiated != nil && u.Initiated.After(deadline) {
+			return nil
+		}
+		if cfg.DryRun {
+			fmt.Printf("(dry run) abort: s3://%s/%s %s\n", bucket, u.Key, u.UploadID)
+		} else if err := abort(ctx, s3Client, bucket, u.Key, u.UploadID); err != nil {
+			slog.Error("Abort failed", "key", u.Key, "upload_id", u.UploadID, "err", err)
+			failed++
+			return nil
+		} else {
+			fmt.Printf("abort: s3://%s/%s %s\n", bucket, u.Key, u.UploadID)
+		}
+		aborted++
+		return nil
+	})
+	dryRun := ""
+	if cfg.DryRun {
+		dryRun = "(dry run) "
+	}
+	slog.Info("Cleanup", "result", fmt.Sprintf("%saborted: %d, failed: %d", dryRun, aborted, failed))
+	return err
+}
+
+// Walk pages through ListMultipartUploads, stopping at the first error of fn.
+func Walk(ctx context.Context, s3Client *s3.Client, bucket, prefix string, fn func(Upload) error) error {
+	input := &s3.ListMultipartUploadsInput{Bucket: aws.String(bucket)}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	for {
+		out, err := s3Client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, u := range out.Uploads {
+			err = fn(Upload{
+				Key:          aws.ToString(u.Key),
+				UploadID:     aws.ToString(u.UploadId),
+				Initiated:    u.Initiated,
+				StorageClass: string(u.StorageClass),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if !out.IsTruncated {
+			return nil
+		}
+		input.KeyMarker, input.UploadIdMarker = out.NextKeyMarker, out.NextUploadIdMarker
+	}
+}
+
+// Parts pages through ListParts.
+func Parts(ctx context.Context, s3Client *s3.Client, bucket, key, uploadID string) ([]Part, error) {
+	input := &s3.ListPartsInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}
+	var parts []Part
+	for {
+		out, err := s3Client.ListParts(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range out.Parts {
+			parts = append(parts, makePart(p))
+		}
+		if !out.IsTruncated {
+			return parts, nil
+		}
+		input.PartNumberMarker = out.NextPartNumberMarker
+	}
+}
+
+func makePart(p types.Part) Part {
+	return Part{
+		PartNumber:   p.PartNumber,
+		Size:         p.Size,
+		ETag:         aws.ToString(p.ETag),
+		LastModified: p.LastModified,
+		Checksum:     checksum(p),
+	}
+}
+
+// checksum returns the additional checksum of the part, whichever it is.
+func checksum(p types.Part) string {
+	for _, c := range []*string{p.ChecksumCRC32, p.ChecksumCRC32C, p.ChecksumSHA1, p.ChecksumSHA256} {
+		if c != nil {
+			return *c
+		}
+	}
+	return ""
+}
+
+func abort(ctx context.Context, s3Client *s3.Client, bucket, key, uploadID string) error {
+	_, err := s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	return err
+}
+
+// resolveKey finds the key of the upload id when it is not given.
+func resolveKey(ctx context.Context, s3Client *s3.Client, bucket, key, uploadID string) (string, error) {
+	if key != "" {
+		return key, nil
+	}
+	errFound := fmt.Errorf("found")
+	err := Walk(ctx, s3Client, bucket, "", func(u Upload) error {
+		if u.UploadID == uploadID {
+			key = u.Key
+			return errFound
+		}
+		return nil
+	})
+	if err == errFound {
+		return key, nil
+	} else if err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no multipart upload %s in bucket %s", uploadID, bucket)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Local().Format(timeLayout)
+}
@@ -0,0 +1,74 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/datagen"
+)
+
+// consumeBody reads the body like readBody, computing the cfg.Checksum
+// checksums and the ETag to compare with those in the header and, with
+// cfg.VerifyGenerated, comparing the data with the stream the metadata
+// says it was generated from.
+func consumeBody(cfg config.Config, header http.Header, body io.Reader, size int64) {
+	sums := checksum.New(append([]string{checksum.MD5}, cfg.Checksum...)...)
+	w := []io.Writer{sums}
+	writers := etagWriters(cfg, header.Get("ETag"), size)
+	for _, e := range writers {
+		w = append(w, e)
+	}
+	var v *datagen.Verifier
+	if cfg.VerifyGenerated {
+		expected, err := datagen.FromMetadata(headerMetadata(header))
+		if err != nil {
+			slog.Error("Verify failed", "err", err)
+			return
+		}
+		v = datagen.NewVerifier(expected)
+		w = append(w, v)
+	}
+	readBody(cfg, body, io.MultiWriter(w...))
+	logChecksums(sums, checksum.FromHeader(header))
+	logETag(writers, sums.Sum(checksum.MD5), header)
+	if v != nil {
+		logVerified(v, size)
+	}
+}
+
+// logChecksums reports the checksums but MD5, which readBody reports, and
+// compares them with the server's.
+func logChecksums(sums *checksum.Set, server map[string]string) {
+	for _, name := range sums.Names() {
+		if name != checksum.MD5 {
+			slog.Info("Get object", "result", fmt.Sprintf("%s: %s", name, sums.Hex(name)))
+		}
+	}
+	matched, skipped, err := checksum.Compare(sums, server)
+	if err != nil {
+		slog.Error("Checksum failed", "err", err)
+	}
+	for _, name := range matched {
+		slog.Info("Get object", "result", fmt.Sprintf("%s: matches the server", name))
+	}
+	for _, name := range skipped {
+		slog.Info("Get object", "result", fmt.Sprintf("%s: the server has a checksum of the parts", name))
+	}
+}
+
+// rawHeader returns the HTTP header of an SDK response, for the checksums
+// and metadata the SDK does not decode.
+func rawHeader(metadata middleware.Metadata) http.Header {
+	if res, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+		return res.Header
+	}
+	return http.Header{}
+}
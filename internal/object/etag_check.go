@@ -0,0 +1,79 @@
+package object
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/etag"
+)
+
+// etagWriters compute the ETag the object should have when uploaded in
+// parts of cfg.PartSize or, when it is not given, of the part sizes that
+// give the parts count of the server ETag. A plain MD5 ETag needs none,
+// the MD5 of the data is compared.
+func etagWriters(cfg config.Config, server string, size int64) []*etag.Writer {
+	if server == "" || plainETag(server) {
+		return nil
+	}
+	var sizes []int64
+	if cfg.PartSize > 0 {
+		sizes = []int64{int64(cfg.PartSize)}
+	} else if parts := etag.Parts(server); parts > 1 {
+		sizes = etag.PartSizes(size, parts, 0)
+	} else {
+		sizes = []int64{max(size, 1)}
+	}
+	writers := make([]*etag.Writer, 0, len(sizes))
+	for _, ps := range sizes {
+		writers = append(writers, etag.NewWriter(ps))
+	}
+	return writers
+}
+
+// plainETag reports whether the ETag is the MD5 of the object, not of
+// the parts of a multipart upload.
+func plainETag(server string) bool {
+	return !strings.Contains(etag.Trim(server), "-")
+}
+
+// logETag compares the MD5 or the expected multipart ETags with the
+// server's, which is no MD5 when the server encrypts with a key of its
+// own.
+func logETag(writers []*etag.Writer, md5 []byte, header http.Header) {
+	server := etag.Trim(header.Get("ETag"))
+	if server == "" {
+		return
+	}
+	if header.Get("X-Amz-Server-Side-Encryption") == string(types.ServerSideEncryptionAwsKms) ||
+		header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "" {
+		slog.Info("Get object", "result", fmt.Sprintf("etag: server %s (encrypted, not compared)", server))
+		return
+	}
+	if plainETag(server) {
+		if local := hex.EncodeToString(md5); local == server {
+			slog.Info("Get object", "result", fmt.Sprintf("etag: %s, matches the server", local))
+		} else {
+			slog.Error("ETag mismatch", "expected", local, "server", server)
+		}
+		return
+	}
+	if len(writers) == 0 {
+		slog.Error("ETag mismatch", "server", server, "err", "no part size gives its parts count, pass --part-size")
+		return
+	}
+	candidates := make([]string, 0, len(writers))
+	for _, w := range writers {
+		if w.Matches(server) {
+			slog.Info("Get object", "result", fmt.Sprintf("etag: %s (part size %d), matches the server", w.ETag(), w.PartSize()))
+			return
+		}
+		candidates = append(candidates, fmt.Sprintf("%s (part size %d)", w.ETag(), w.PartSize()))
+	}
+	slog.Error("ETag mismatch", "expected", strings.Join(candidates, ", "), "server", server)
+}
@@ -3,177 +3,234 @@ package object
 import (
 	"context"
 	"crypto/md5"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+	"github.com/vskurikhin/awsfiles/internal/client"
 	"github.com/vskurikhin/awsfiles/internal/config"
 )
 
-var zeroTime = new(time.Time)
-
 func GetObject(cfg config.Config) {
-	keys := getKeys(cfg)
-	httpclient := getHTTPClient(cfg)
-	customResolver := getCustomResolver(cfg.S3Host)
-	creeds := credentials.NewStaticCredentialsProvider(keys.AccessKeyID, keys.SecretAccessKey, "")
-	client := s3.NewFromConfig(aws.Config{
-		Credentials:                 creeds,
-		HTTPClient:                  httpclient,
-		EndpointResolverWithOptions: customResolver,
+	if cfg.URL != "" {
+		GetURL(cfg)
+		return
+	}
+	s3Client := client.New(cfg)
+	if cfg.Output != "" {
+		getToFile(cfg, s3Client)
+		return
+	}
+	if cfg.Verbose {
+		slog.Info("Getting object", "client", "prepared")
+	}
+	res, err := clientGetObject(cfg, s3Client)
+	if status := responseStatus(err); status == http.StatusNotModified || status == http.StatusPreconditionFailed {
+		slog.Info("Get object", "result", http.StatusText(status))
+		return
+	} else if err != nil {
+		slog.Error("Get object failed", "err", err)
+		return
+	}
+	defer func() { _ = res.Body.Close() }()
+	consumeBody(cfg, rawHeader(res.ResultMetadata), res.Body, res.ContentLength)
+}
+
+// Download writes s3://bucket/key to the local file at path.
+func Download(cfg config.Config, bucket, key, path string) {
+	fmt.Println()
+	bytesWritten, sum, err := DownloadFile(context.Background(), cfg, client.New(cfg), bucket, key, path)
+	if err != nil {
+		slog.Error("Get object failed", "err", err)
+		return
+	}
+	fmt.Println()
+	slog.Info("Get object", "result", fmt.Sprintf("total read bytes: %d", bytesWritten))
+	slog.Info("Get object", "result", fmt.Sprintf("md5sum: %s", hex.EncodeToString(sum)))
+}
+
+// DownloadFile writes the object to path, keeping its Last-Modified as the
+// file's mtime, and returns the bytes written and their MD5.
+func DownloadFile(ctx context.Context, cfg config.Config, s3Client *s3.Client, bucket, key, path string) (int64, []byte, error) {
+	res, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
 	})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	n, sum, err := copyBody(cfg, res.Body, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, sum, err
+	}
+	if res.LastModified != nil {
+		err = os.Chtimes(path, *res.LastModified, *res.LastModified)
+	}
+	return n, sum, err
+}
+
+// GetURL downloads a presigned URL through the same transport as the S3
+// client, so the Address, CA and SNI overrides still apply.
+func GetURL(cfg config.Config) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		slog.Error("Get object failed", "err", err)
+		return
+	}
+	if u.Scheme == "https" {
+		// The transport negotiates TLS itself in dialContextFunc.
+		u.Scheme = "http"
+	}
+	req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		slog.Error("Get object failed", "err", err)
+		return
+	}
 	if cfg.Verbose {
 		slog.Info("Getting object", "client", "prepared")
 	}
-	res, err := clientGetObject(cfg, client)
+	res, err := client.HTTPClient(cfg).Do(req)
 	if err != nil {
 		slog.Error("Get object failed", "err", err)
 		return
 	}
-	hasher := md5.New()
-	b := make([]byte, cfg.BufferSize)
-	bytesWritten := 0
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		slog.Error("Get object failed", "status", res.Status, "body", string(body))
+		return
+	}
+	consumeBody(cfg, res.Header, res.Body, res.ContentLength)
+}
+
+// readBody hashes the body, copying it to w unless w is nil.
+func readBody(cfg config.Config, body io.Reader, w io.Writer) {
 	fmt.Println()
-	for {
-		i, err := res.Body.Read(b)
-		if err != nil && err != io.EOF {
-			fmt.Printf("\nerror: %v\n", err.Error())
-			break
-		} else if err == io.EOF {
-			bytesWritten += i
-			hasher.Write(b[:i])
-			break
-		} else {
-			bytesWritten += i
-			hasher.Write(b[:i])
-		}
-		if cfg.Verbose {
-			fmt.Printf("read bytes: %d, total read bytes %d\r", i, bytesWritten)
-		}
+	bytesWritten, sum, err := copyBody(cfg, body, w)
+	if err != nil {
+		fmt.Printf("\nerror: %v\n", err.Error())
 	}
 	fmt.Println()
 	slog.Info("Get object", "result", fmt.Sprintf("total read bytes: %d", bytesWritten))
-	value := hex.EncodeToString(hasher.Sum(nil))
+	value := hex.EncodeToString(sum)
 	slog.Info("Get object", "result", fmt.Sprintf("md5sum: %s", value))
 }
 
-func clientGetObject(cfg config.Config, client *s3.Client) (*s3.GetObjectOutput, error) {
-	return client.GetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(cfg.Bucket),
-		Key:    aws.String(cfg.Key),
-	})
+// copyBody is the read loop of readBody, returning the bytes read and
+// their MD5.
+func copyBody(cfg config.Config, body io.Reader, w io.Writer) (int64, []byte, error) {
+	hasher := md5.New()
+	n, err := hashBody(cfg, hasher, body, w)
+	return n, hasher.Sum(nil), err
 }
 
-func getCustomResolver(s3host string) aws.EndpointResolverWithOptionsFunc {
-	return func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-		if region == "" {
-			region = "us-east-1"
+// hashBody is copyBody adding to the running hash of an earlier read.
+func hashBody(cfg config.Config, hasher io.Writer, body io.Reader, w io.Writer) (int64, error) {
+	if w != nil {
+		body = io.TeeReader(body, w)
+	}
+	b := make([]byte, max(cfg.BufferSize, 1))
+	var bytesWritten int64
+	for {
+		i, err := body.Read(b)
+		bytesWritten += int64(i)
+		hasher.Write(b[:i])
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return bytesWritten, err
 		}
-		if service == s3.ServiceID {
-			return aws.Endpoint{URL: s3host, HostnameImmutable: true, SigningRegion: region}, nil
+		if cfg.Verbose {
+			fmt.Printf("read bytes: %d, total read bytes %d\r", i, bytesWritten)
 		}
-		return aws.Endpoint{}, fmt.Errorf("unknown endpoint requested")
 	}
+	return bytesWritten, nil
 }
 
-func getHTTPClient(cfg config.Config) *http.Client {
-	var tlsCfg *tls.Config
-	if cfg.Ssl() {
-		tlsCfg = createTLSClientConfig(cfg)
-	}
-	transport := &http.Transport{
-		DisableKeepAlives:     false,
-		IdleConnTimeout:       0,
-		TLSHandshakeTimeout:   0,
-		ResponseHeaderTimeout: 0,
-		ExpectContinueTimeout: 0,
-		WriteBufferSize:       cfg.BufferSize,
-		ReadBufferSize:        cfg.BufferSize,
-		TLSClientConfig:       tlsCfg,
-		DialContext:           dialContextFunc(cfg, tlsCfg),
-	}
-	return &http.Client{
-		Transport: transport,
-		Timeout:   0,
+func clientGetObject(cfg config.Config, client *s3.Client) (*s3.GetObjectOutput, error) {
+	input, err := getObjectInput(cfg)
+	if err != nil {
+		return nil, err
 	}
+	return client.GetObject(context.TODO(), input)
 }
 
-func createTLSClientConfig(cfg config.Config) *tls.Config {
-	certs := x509.NewCertPool()
-
-	if cfg.CAFile != "" {
-		pemData, err := os.ReadFile(cfg.CAFile)
+// getObjectInput applies the conditional settings.
+func getObjectInput(cfg config.Config) (*s3.GetObjectInput, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(cfg.Key),
+	}
+	if cfg.IfMatch != "" {
+		input.IfMatch = aws.String(cfg.IfMatch)
+	}
+	if cfg.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(cfg.IfNoneMatch)
+	}
+	if cfg.IfModifiedSince != "" {
+		t, err := parseTime(cfg.IfModifiedSince)
 		if err != nil {
-			slog.Error("Read certificate failed", "err", err)
+			return nil, err
 		}
-		certs.AppendCertsFromPEM(pemData)
-	}
-	return &tls.Config{
-		MinVersion: tls.VersionTLS12,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-			tls.TLS_AES_128_GCM_SHA256,
-			tls.TLS_AES_256_GCM_SHA384,
-			tls.TLS_CHACHA20_POLY1305_SHA256,
-		},
-		RootCAs:            certs,
-		InsecureSkipVerify: cfg.InsecureSkipVerify,
-		NextProtos: []string{
-			"http/1.1",
-			"h2",
-		},
+		input.IfModifiedSince = &t
 	}
+	if len(cfg.Checksum) > 0 {
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
+	return input, nil
 }
 
-func dialContextFunc(cfg config.Config, tlsCfg *tls.Config) func(ctx context.Context, network string, addr string) (net.Conn, error) {
-	if cfg.Ssl() {
-		return func(ctx context.Context, network string, addr string) (net.Conn, error) {
-			tlsCfg.ServerName = cfg.ServerName
-			conn, err := tls.Dial("tcp", cfg.Address, tlsCfg)
-			if err != nil {
-				return nil, err
-			}
-			if cfg.Debug {
-				slog.Debug(
-					"connected",
-					"ServerName", conn.ConnectionState().ServerName,
-					"NegotiatedProtocol", conn.ConnectionState().NegotiatedProtocol,
-					"HandshakeComplete", conn.ConnectionState().HandshakeComplete)
-			}
-			err = conn.SetDeadline(*zeroTime)
-			return conn, err
-		}
+// parseTime accepts RFC 3339 as well as the HTTP date format.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
 	}
-	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
-		conn, err := net.Dial("tcp", cfg.Address)
-		if err != nil {
-			fmt.Println("dial connection failed", "err", err)
-			return nil, err
-		}
-		err = conn.SetDeadline(*zeroTime)
-		return conn, err
+	return http.ParseTime(s)
+}
+
+// responseStatus returns the HTTP status of a failed S3 call, or zero.
+func responseStatus(err error) int {
+	var re *awshttp.ResponseError
+	if errors.As(err, &re) {
+		return re.HTTPStatusCode()
 	}
+	return 0
 }
 
-func getKeys(cfg config.Config) aws.Credentials {
-	return aws.Credentials{
-		AccessKeyID:     cfg.AccessKeyID,
-		SecretAccessKey: cfg.SecretAccessKey,
+// Fetch reads cfg.Bucket/cfg.Key the way GetObject does, hashing it with
+// MD5 and the cfg.Checksum checksums, and returns the bytes read and the
+// response header.
+func Fetch(ctx context.Context, cfg config.Config, s3Client *s3.Client) (int64, *checksum.Set, http.Header, error) {
+	input, err := getObjectInput(cfg)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	res, err := s3Client.GetObject(ctx, input)
+	if err != nil {
+		return 0, nil, nil, err
 	}
+	defer func() { _ = res.Body.Close() }()
+	sums := checksum.New(append([]string{checksum.MD5}, cfg.Checksum...)...)
+	n, err := hashBody(cfg, sums, res.Body, nil)
+	return n, sums, rawHeader(res.ResultMetadata), err
 }
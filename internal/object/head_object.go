@@ -0,0 +1,145 @@
+package object
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+// Stat is the metadata reported by HeadObject.
+type Stat struct {
+	Bucket                    string            `json:"bucket"`
+	Key                       string            `json:"key"`
+	ContentLength             int64             `json:"content_length"`
+	ETag                      string            `json:"etag,omitempty"`
+	LastModified              *time.Time        `json:"last_modified,omitempty"`
+	ContentType               string            `json:"content_type,omitempty"`
+	ContentEncoding           string            `json:"content_encoding,omitempty"`
+	CacheControl              string            `json:"cache_control,omitempty"`
+	StorageClass              string            `json:"storage_class,omitempty"`
+	PartsCount                int32             `json:"parts_count,omitempty"`
+	ServerSideEncryption      string            `json:"server_side_encryption,omitempty"`
+	SSEKMSKeyID               string            `json:"sse_kms_key_id,omitempty"`
+	SSECustomerAlgorithm      string            `json:"sse_customer_algorithm,omitempty"`
+	BucketKeyEnabled          bool              `json:"bucket_key_enabled,omitempty"`
+	VersionID                 string            `json:"version_id,omitempty"`
+	ObjectLockMode            string            `json:"object_lock_mode,omitempty"`
+	ObjectLockRetainUntilDate *time.Time        `json:"object_lock_retain_until_date,omitempty"`
+	ObjectLockLegalHoldStatus string            `json:"object_lock_legal_hold_status,omitempty"`
+	ChecksumCRC32             string            `json:"checksum_crc32,omitempty"`
+	ChecksumCRC32C            string            `json:"checksum_crc32c,omitempty"`
+	ChecksumSHA1              string            `json:"checksum_sha1,omitempty"`
+	ChecksumSHA256            string            `json:"checksum_sha256,omitempty"`
+	Metadata                  map[string]string `json:"metadata,omitempty"`
+}
+
+// HeadObject prints the metadata of cfg.Bucket/cfg.Key. The error tells
+// callers whether the object exists.
+func HeadObject(cfg config.Config) error {
+	stat, err := Head(context.Background(), client.New(cfg), cfg.Bucket, cfg.Key)
+	if err != nil {
+		return err
+	}
+	if cfg.Format == config.FormatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stat)
+	}
+	printStat(stat)
+	return nil
+}
+
+// Head fetches the metadata of the object, with checksums if the server
+// stored any.
+func Head(ctx context.Context, s3Client *s3.Client, bucket, key string) (Stat, error) {
+	out, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return Stat{}, err
+	}
+	return Stat{
+		Bucket:                    bucket,
+		Key:                       key,
+		ContentLength:             out.ContentLength,
+		ETag:                      strings.Trim(aws.ToString(out.ETag), `"`),
+		LastModified:              out.LastModified,
+		ContentType:               aws.ToString(out.ContentType),
+		ContentEncoding:           aws.ToString(out.ContentEncoding),
+		CacheControl:              aws.ToString(out.CacheControl),
+		StorageClass:              string(out.StorageClass),
+		PartsCount:                out.PartsCount,
+		ServerSideEncryption:      string(out.ServerSideEncryption),
+		SSEKMSKeyID:               aws.ToString(out.SSEKMSKeyId),
+		SSECustomerAlgorithm:      aws.ToString(out.SSECustomerAlgorithm),
+		BucketKeyEnabled:          out.BucketKeyEnabled,
+		VersionID:                 aws.ToString(out.VersionId),
+		ObjectLockMode:            string(out.ObjectLockMode),
+		ObjectLockRetainUntilDate: out.ObjectLockRetainUntilDate,
+		ObjectLockLegalHoldStatus: string(out.ObjectLockLegalHoldStatus),
+		ChecksumCRC32:             aws.ToString(out.ChecksumCRC32),
+		ChecksumCRC32C:            aws.ToString(out.ChecksumCRC32C),
+		ChecksumSHA1:              aws.ToString(out.ChecksumSHA1),
+		ChecksumSHA256:            aws.ToString(out.ChecksumSHA256),
+		Metadata:                  out.Metadata,
+	}, nil
+}
+
+func printStat(stat Stat) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	line := func(name string, value any) {
+		if s := fmt.Sprint(value); s != "" && s != "0" && s != "false" {
+			_, _ = fmt.Fprintf(tw, "%s:\t%s\n", name, s)
+		}
+	}
+	timeValue := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	line("Object", "s3://"+stat.Bucket+"/"+stat.Key)
+	_, _ = fmt.Fprintf(tw, "Content-Length:\t%d\n", stat.ContentLength)
+	line("ETag", stat.ETag)
+	line("Last-Modified", timeValue(stat.LastModified))
+	line("Content-Type", stat.ContentType)
+	line("Content-Encoding", stat.ContentEncoding)
+	line("Cache-Control", stat.CacheControl)
+	line("Storage-Class", stat.StorageClass)
+	line("Parts-Count", stat.PartsCount)
+	line("SSE", stat.ServerSideEncryption)
+	line("SSE-KMS-Key-Id", stat.SSEKMSKeyID)
+	line("SSE-C-Algorithm", stat.SSECustomerAlgorithm)
+	line("Bucket-Key-Enabled", stat.BucketKeyEnabled)
+	line("Version-Id", stat.VersionID)
+	line("Object-Lock-Mode", stat.ObjectLockMode)
+	line("Object-Lock-Retain-Until", timeValue(stat.ObjectLockRetainUntilDate))
+	line("Object-Lock-Legal-Hold", stat.ObjectLockLegalHoldStatus)
+	line("Checksum-CRC32", stat.ChecksumCRC32)
+	line("Checksum-CRC32C", stat.ChecksumCRC32C)
+	line("Checksum-SHA1", stat.ChecksumSHA1)
+	line("Checksum-SHA256", stat.ChecksumSHA256)
+	names := make([]string, 0, len(stat.Metadata))
+	for name := range stat.Metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line("Meta-"+name, stat.Metadata[name])
+	}
+	_ = tw.Flush()
+}
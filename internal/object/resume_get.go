@@ -0,0 +1,293 @@
+package object
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/etag"
+)
+
+// maxBackoff caps the wait between the retries of a download.
+const maxBackoff = 30 * time.Second
+
+// partial is the sidecar of an interrupted download, naming the version of
+// the object the file holds a prefix of.
+type partial struct {
+	ETag string `json:"etag"`
+	Size int64  `json:"size"`
+}
+
+// getToFile downloads the object to cfg.Output, resuming with ranged
+// requests after a drop.
+func getToFile(cfg config.Config, s3Client *s3.Client) {
+	fmt.Println()
+	d, err := downloadResumable(context.Background(), cfg, s3Client)
+	if status := responseStatus(err); status == http.StatusNotModified || status == http.StatusPreconditionFailed {
+		slog.Info("Get object", "result", http.StatusText(status))
+		return
+	} else if err != nil {
+		slog.Error("Get object failed", "err", err)
+		return
+	}
+	fmt.Println()
+	slog.Info("Get object", "result", fmt.Sprintf("total read bytes: %d", d.n))
+	slog.Info("Get object", "result", fmt.Sprintf("md5sum: %s", d.sums.Hex(checksum.MD5)))
+	server := map[string]string{}
+	if d.whole {
+		server = checksum.FromHeader(d.header)
+	}
+	logChecksums(d.sums, server)
+	if d.header != nil {
+		logETag(d.tags, d.sums.Sum(checksum.MD5), d.header)
+	}
+	if cfg.VerifyGenerated {
+		verifyFile(cfg.Output, headerMetadata(d.header), d.n)
+	}
+}
+
+// download is what downloadResumable read.
+type download struct {
+	n    int64
+	sums *checksum.Set
+	// tags compute the multipart ETags of the object along with sums.
+	tags []*etag.Writer
+	// header is of the last response, its checksums are of the object
+	// when whole is true, that is no range was requested.
+	header http.Header
+	whole  bool
+}
+
+// hasher writes to the checksums and the ETag writers.
+func (d *download) hasher() io.Writer {
+	w := []io.Writer{d.sums}
+	for _, tag := range d.tags {
+		w = append(w, tag)
+	}
+	return io.MultiWriter(w...)
+}
+
+// downloadResumable writes the object to cfg.Output. After the first
+// response every request asks for the bytes not yet written with If-Match
+// on the first ETag, so the file never mixes two versions. With cfg.Resume
+// a file left by an earlier run is continued, rehashing what it holds.
+// The data is hashed with MD5 and the cfg.Checksum checksums.
+func downloadResumable(ctx context.Context, cfg config.Config, s3Client *s3.Client) (download, error) {
+	path, sidecar := cfg.Output, cfg.Output+".resume"
+	d := download{sums: checksum.New(append([]string{checksum.MD5}, cfg.Checksum...)...), whole: true}
+	var state partial
+	n := &d.n
+	if cfg.Resume {
+		var err error
+		if state, err = loadPartial(sidecar); err != nil {
+			return d, err
+		}
+		d.tags = etagWriters(cfg, state.ETag, state.Size)
+		if *n, err = rehash(path, state.Size, d.hasher()); err != nil {
+			return d, err
+		}
+	}
+	// f is opened on the first response, so a failed request leaves no
+	// file behind.
+	var f *os.File
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+		}
+	}()
+	if *n > 0 {
+		slog.Info("Get object", "resume", fmt.Sprintf("from byte %d of %d", *n, state.Size))
+	}
+	var lastModified *time.Time
+	for attempt := 0; ; attempt++ {
+		if state.ETag != "" && *n == state.Size {
+			break
+		}
+		ranged := *n > 0
+		res, err := getFrom(ctx, cfg, s3Client, state.ETag, *n)
+		if err == nil && ranged {
+			if err = checkRange(res, *n, state.Size); err != nil {
+				_ = res.Body.Close()
+				return d, err
+			}
+		}
+		if err == nil {
+			if state.ETag == "" {
+				state = partial{ETag: aws.ToString(res.ETag), Size: res.ContentLength}
+				d.tags = etagWriters(cfg, state.ETag, state.Size)
+				if err = savePartial(sidecar, state); err != nil {
+					_ = res.Body.Close()
+					return d, err
+				}
+			}
+			if f == nil {
+				if f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644); err != nil {
+					_ = res.Body.Close()
+					return d, err
+				}
+			}
+			lastModified, d.header = res.LastModified, rawHeader(res.ResultMetadata)
+			d.whole = d.whole && !ranged
+			err = writeFrom(cfg, f, d.hasher(), res.Body, n)
+		}
+		if err == nil {
+			break
+		}
+		if responseStatus(err) == http.StatusPreconditionFailed && state.ETag != "" {
+			return d, fmt.Errorf("object changed since the download started, remove %s to start over", sidecar)
+		}
+		if !retryable(err) || attempt >= cfg.Retries {
+			return d, err
+		}
+		backoff := min(time.Second<<attempt, maxBackoff)
+		slog.Warn("Get object interrupted, retrying", "attempt", attempt+1, "offset", *n, "backoff", backoff, "err", err)
+		time.Sleep(backoff)
+	}
+	if f != nil {
+		err := f.Close()
+		f = nil
+		if err != nil {
+			return d, err
+		}
+	}
+	if *n != state.Size {
+		return d, fmt.Errorf("read %d bytes of %d", *n, state.Size)
+	}
+	if lastModified != nil {
+		_ = os.Chtimes(path, *lastModified, *lastModified)
+	}
+	_ = os.Remove(sidecar)
+	return d, nil
+}
+
+// getFrom requests the object from offset on, guarded by etag once known.
+func getFrom(ctx context.Context, cfg config.Config, s3Client *s3.Client, etag string, offset int64) (*s3.GetObjectOutput, error) {
+	input, err := getObjectInput(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		input.IfMatch = aws.String(etag)
+		input.IfNoneMatch, input.IfModifiedSince = nil, nil
+	}
+	if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+	return s3Client.GetObject(ctx, input)
+}
+
+// checkRange makes sure the response of a ranged request holds the bytes
+// from offset to the end of the object, not the whole object of a server
+// that ignored the Range.
+func checkRange(res *s3.GetObjectOutput, offset, size int64) error {
+	status := 0
+	if raw, ok := awsmiddleware.GetRawResponse(res.ResultMetadata).(*smithyhttp.Response); ok {
+		status = raw.StatusCode
+	}
+	if status != http.StatusPartialContent {
+		return fmt.Errorf("range from byte %d answered with status %d, not %d", offset, status, http.StatusPartialContent)
+	}
+	var first, last, total int64
+	contentRange := aws.ToString(res.ContentRange)
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &first, &last, &total); err != nil || first != offset || last != size-1 || total != size {
+		return fmt.Errorf("range from byte %d of %d answered with Content-Range %q", offset, size, contentRange)
+	}
+	return nil
+}
+
+// writeFrom writes body to f after the *n bytes already there, advancing
+// *n by what was written.
+func writeFrom(cfg config.Config, f *os.File, hasher io.Writer, body io.ReadCloser, n *int64) error {
+	defer func() { _ = body.Close() }()
+	if err := f.Truncate(*n); err != nil {
+		return err
+	}
+	if _, err := f.Seek(*n, io.SeekStart); err != nil {
+		return err
+	}
+	written, err := hashBody(cfg, hasher, bodyReader{r: body}, f)
+	*n += written
+	return err
+}
+
+// retryable reports whether the download may continue after err: a
+// request that did not reach the server, a body that broke off or a server
+// error. Local errors such as a full disk and client errors of the server,
+// a changed object above all, end it.
+func retryable(err error) bool {
+	var sendErr *smithyhttp.RequestSendError
+	var readErr *bodyReadError
+	return errors.As(err, &sendErr) || errors.As(err, &readErr) || responseStatus(err) >= http.StatusInternalServerError
+}
+
+// bodyReadError is a failure to read the response body, told apart from
+// the failures to write the file.
+type bodyReadError struct {
+	err error
+}
+
+func (e *bodyReadError) Error() string { return e.err.Error() }
+func (e *bodyReadError) Unwrap() error { return e.err }
+
+// bodyReader marks the read errors of r as bodyReadError.
+type bodyReader struct {
+	r io.Reader
+}
+
+func (b bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &bodyReadError{err: err}
+	}
+	return n, err
+}
+
+// loadPartial reads the sidecar an earlier run left, the zero partial
+// when there is none.
+func loadPartial(sidecar string) (partial, error) {
+	var state partial
+	b, err := os.ReadFile(sidecar)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+	if err = json.Unmarshal(b, &state); err != nil {
+		return state, fmt.Errorf("%s: %w", sidecar, err)
+	}
+	return state, nil
+}
+
+// rehash hashes the up to size bytes the file an earlier run left holds,
+// returning their length.
+func rehash(path string, size int64, hasher io.Writer) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	return io.Copy(hasher, io.LimitReader(f, size))
+}
+
+func savePartial(sidecar string, state partial) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sidecar, b, 0o644)
+}
@@ -0,0 +1,56 @@
+package object
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/vskurikhin/awsfiles/internal/datagen"
+)
+
+// metaPrefix is the header prefix of user metadata.
+const metaPrefix = "X-Amz-Meta-"
+
+// verifyFile compares the downloaded file with the stream the metadata
+// says it was generated from.
+func verifyFile(path string, metadata map[string]string, size int64) {
+	expected, err := datagen.FromMetadata(metadata)
+	if err != nil {
+		slog.Error("Verify failed", "err", err)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		slog.Error("Verify failed", "err", err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	v := datagen.NewVerifier(expected)
+	if _, err = io.Copy(v, f); err != nil {
+		slog.Error("Verify failed", "err", err)
+		return
+	}
+	logVerified(v, size)
+}
+
+func logVerified(v *datagen.Verifier, size int64) {
+	if err := v.Err(size); err != nil {
+		slog.Error("Verify failed", "err", err)
+		return
+	}
+	slog.Info("Verify", "result", "data matches the generated stream")
+}
+
+// headerMetadata returns the user metadata of a response the way the SDK
+// does, lower-case and without the prefix.
+func headerMetadata(header http.Header) map[string]string {
+	metadata := make(map[string]string)
+	for name, values := range header {
+		if len(values) > 0 && strings.HasPrefix(name, metaPrefix) {
+			metadata[strings.ToLower(strings.TrimPrefix(name, metaPrefix))] = values[0]
+		}
+	}
+	return metadata
+}
@@ -0,0 +1,203 @@
+package presign
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+const sseCustomerAlgorithm = "AES256"
+
+// Presign prints a presigned URL for the method on cfg.Bucket/cfg.Key
+// together with the headers the holder of the URL has to send.
+func Presign(cfg config.Config, method string) {
+	if cfg.Anonymous {
+		slog.Error("Presign failed", "err", "anonymous requests can not be presigned")
+		return
+	}
+	ctx := context.Background()
+	req, err := presign(ctx, cfg, method)
+	if err != nil {
+		slog.Error("Presign failed", "err", err)
+		return
+	}
+	fmt.Println(req.URL)
+	names := make([]string, 0, len(req.SignedHeader))
+	for name := range req.SignedHeader {
+		if !strings.EqualFold(name, "host") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s: %s\n", name, strings.Join(req.SignedHeader[name], ","))
+	}
+	if cfg.Verify {
+		verify(ctx, cfg, req)
+	}
+}
+
+func presign(ctx context.Context, cfg config.Config, method string) (*v4.PresignedHTTPRequest, error) {
+	sse, err := sseCustomer(cfg.SSECustomerKey)
+	if err != nil {
+		return nil, err
+	}
+	signer := headerPresigner{HTTPPresignerV4: v4.NewSigner(), header: make(http.Header)}
+	pc := s3.NewPresignClient(client.New(cfg), s3.WithPresignExpires(cfg.Expires), func(o *s3.PresignOptions) {
+		o.Presigner = &signer
+	})
+	var req *v4.PresignedHTTPRequest
+	switch method {
+	case http.MethodGet:
+		req, err = pc.PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket:               aws.String(cfg.Bucket),
+			Key:                  aws.String(cfg.Key),
+			SSECustomerAlgorithm: sse.algorithm,
+			SSECustomerKey:       sse.key,
+			SSECustomerKeyMD5:    sse.keyMD5,
+		})
+	case http.MethodPut:
+		if cfg.ContentType != "" {
+			// The SDK strips Content-Type from presigned PUTs, sign it anyway.
+			signer.header.Set("Content-Type", cfg.ContentType)
+		}
+		req, err = pc.PresignPutObject(ctx, &s3.PutObjectInput{
+			Bucket:               aws.String(cfg.Bucket),
+			Key:                  aws.String(cfg.Key),
+			SSECustomerAlgorithm: sse.algorithm,
+			SSECustomerKey:       sse.key,
+			SSECustomerKeyMD5:    sse.keyMD5,
+		})
+	case http.MethodHead:
+		req, err = pc.PresignHeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:               aws.String(cfg.Bucket),
+			Key:                  aws.String(cfg.Key),
+			SSECustomerAlgorithm: sse.algorithm,
+			SSECustomerKey:       sse.key,
+			SSECustomerKeyMD5:    sse.keyMD5,
+		})
+	case http.MethodDelete:
+		// The SDK has no PresignDeleteObject: the HEAD request resolves the
+		// same URL and is signed as a DELETE.
+		signer.method = http.MethodDelete
+		req, err = pc.PresignHeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(cfg.Bucket),
+			Key:    aws.String(cfg.Key),
+		})
+	default:
+		return nil, fmt.Errorf("unsupported method %s", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Ssl() {
+		// The client sees http:// because dialContextFunc negotiates TLS itself.
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return nil, err
+		}
+		u.Scheme = "https"
+		req.URL = u.String()
+	}
+	return req, nil
+}
+
+// verify sends the presigned request through the custom transport.
+func verify(ctx context.Context, cfg config.Config, presigned *v4.PresignedHTTPRequest) {
+	u, err := url.Parse(presigned.URL)
+	if err != nil {
+		slog.Error("Verify failed", "err", err)
+		return
+	}
+	if u.Scheme == "https" {
+		u.Scheme = "http"
+	}
+	req, err := http.NewRequestWithContext(ctx, presigned.Method, u.String(), http.NoBody)
+	if err != nil {
+		slog.Error("Verify failed", "err", err)
+		return
+	}
+	for name, values := range presigned.SignedHeader {
+		if !strings.EqualFold(name, "host") {
+			req.Header[name] = values
+		}
+	}
+	start := time.Now()
+	res, err := client.HTTPClient(cfg).Do(req)
+	if err != nil {
+		slog.Error("Verify failed", "err", err)
+		return
+	}
+	defer func() { _ = res.Body.Close() }()
+	n, err := io.Copy(io.Discard, res.Body)
+	if err != nil {
+		slog.Error("Verify failed", "err", err)
+		return
+	}
+	if res.StatusCode/100 != 2 {
+		slog.Error("Verify failed", "method", presigned.Method, "status", res.Status, "bytes", n)
+		return
+	}
+	slog.Info("Verify", "method", presigned.Method, "status", res.Status, "bytes", n, "elapsed", time.Since(start))
+}
+
+type sseCustomerParams struct {
+	algorithm, key, keyMD5 *string
+}
+
+// sseCustomer accepts a 32-byte SSE-C key either raw or base64 encoded.
+func sseCustomer(key string) (sseCustomerParams, error) {
+	if key == "" {
+		return sseCustomerParams{}, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		raw = []byte(key)
+	}
+	if len(raw) != 32 {
+		return sseCustomerParams{}, fmt.Errorf("SSE-C key must be 32 bytes, got %d", len(raw))
+	}
+	sum := md5.Sum(raw)
+	return sseCustomerParams{
+		algorithm: aws.String(sseCustomerAlgorithm),
+		key:       aws.String(base64.StdEncoding.EncodeToString(raw)),
+		keyMD5:    aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+	}, nil
+}
+
+// headerPresigner signs the request with extra headers and, if set,
+// another method.
+type headerPresigner struct {
+	s3.HTTPPresignerV4
+	header http.Header
+	method string
+}
+
+func (p *headerPresigner) PresignHTTP(
+	ctx context.Context, credentials aws.Credentials, r *http.Request,
+	payloadHash string, service string, region string, signingTime time.Time,
+	optFns ...func(*v4.SignerOptions),
+) (string, http.Header, error) {
+	if p.method != "" {
+		r.Method = p.method
+	}
+	for name, values := range p.header {
+		r.Header[name] = values
+	}
+	return p.HTTPPresignerV4.PresignHTTP(ctx, credentials, r, payloadHash, service, region, signingTime, optFns...)
+}
@@ -0,0 +1,145 @@
+package remove
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/listing"
+)
+
+// batchSize is the most keys a DeleteObjects call accepts.
+const batchSize = 1000
+
+// Summary counts the outcome of a removal.
+type Summary struct {
+	Deleted atomic.Int64
+	Failed  atomic.Int64
+}
+
+// Remove deletes s3://bucket/key, or with cfg.Recursive every object under
+// the key prefix that passes the listing filter.
+func Remove(cfg config.Config, bucket, key string) {
+	ctx := context.Background()
+	s3Client := client.New(cfg)
+	var summary Summary
+	if cfg.Recursive {
+		if err := removePrefix(ctx, cfg, s3Client, bucket, key, &summary); err != nil {
+			slog.Error("Remove failed", "err", err)
+		}
+	} else {
+		removeKey(ctx, cfg, s3Client, bucket, key, &summary)
+	}
+	prefix := ""
+	if cfg.DryRun {
+		prefix = "(dry run) "
+	}
+	slog.Info("Remove", "result", fmt.Sprintf("%sdeleted: %d, failed: %d",
+		prefix, summary.Deleted.Load(), summary.Failed.Load()))
+}
+
+func removeKey(ctx context.Context, cfg config.Config, s3Client *s3.Client, bucket, key string, summary *Summary) {
+	if cfg.DryRun {
+		fmt.Printf("(dry run) delete: s3://%s/%s\n", bucket, key)
+		summary.Deleted.Add(1)
+		return
+	}
+	_, err := s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		slog.Error("Delete failed", "key", key, "err", err)
+		summary.Failed.Add(1)
+		return
+	}
+	if cfg.Verbose {
+		fmt.Printf("delete: s3://%s/%s\n", bucket, key)
+	}
+	summary.Deleted.Add(1)
+}
+
+// removePrefix lists the prefix and hands batches of keys to
+// cfg.Concurrency workers calling DeleteObjects.
+func removePrefix(ctx context.Context, cfg config.Config, s3Client *s3.Client, bucket, prefix string, summary *Summary) error {
+	filter, err := listing.MakeFilter(cfg)
+	if err != nil {
+		return err
+	}
+	batches := make(chan []types.ObjectIdentifier)
+	var wg sync.WaitGroup
+	for i := 0; i < max(cfg.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				deleteBatch(ctx, cfg, s3Client, bucket, batch, summary)
+			}
+		}()
+	}
+	batch := make([]types.ObjectIdentifier, 0, batchSize)
+	err = listing.Walk(ctx, s3Client, bucket, prefix, true, func(e listing.Entry) bool {
+		if !filter.Match(e) {
+			return true
+		}
+		batch = append(batch, types.ObjectIdentifier{Key: aws.String(e.Key)})
+		if len(batch) == batchSize {
+			batches <- batch
+			batch = make([]types.ObjectIdentifier, 0, batchSize)
+		}
+		return true
+	})
+	if len(batch) > 0 {
+		batches <- batch
+	}
+	close(batches)
+	wg.Wait()
+	return err
+}
+
+func deleteBatch(ctx context.Context, cfg config.Config, s3Client *s3.Client, bucket string, batch []types.ObjectIdentifier, summary *Summary) {
+	if cfg.DryRun {
+		for _, obj := range batch {
+			fmt.Printf("(dry run) delete: s3://%s/%s\n", bucket, aws.ToString(obj.Key))
+		}
+		summary.Deleted.Add(int64(len(batch)))
+		return
+	}
+	out, err := s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &types.Delete{Objects: batch, Quiet: !cfg.Verbose},
+	})
+	if err != nil {
+		slog.Error("Delete batch failed", "keys", len(batch), "err", err)
+		summary.Failed.Add(int64(len(batch)))
+		return
+	}
+	for _, e := range out.Errors {
+		slog.Error("Delete failed", "key", aws.ToString(e.Key), "code", aws.ToString(e.Code), "err", aws.ToString(e.Message))
+	}
+	for _, d := range out.Deleted {
+		fmt.Printf("delete: s3://%s/%s\n", bucket, aws.ToString(d.Key))
+	}
+	summary.Failed.Add(int64(len(out.Errors)))
+	summary.Deleted.Add(int64(len(batch) - len(out.Errors)))
+}
+
+// DeleteKeys deletes the keys of the bucket in DeleteObjects batches.
+func DeleteKeys(ctx context.Context, cfg config.Config, s3Client *s3.Client, bucket string, keys []string, summary *Summary) {
+	for start := 0; start < len(keys); start += batchSize {
+		end := min(start+batchSize, len(keys))
+		batch := make([]types.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			batch = append(batch, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+		deleteBatch(ctx, cfg, s3Client, bucket, batch, summary)
+	}
+}
@@ -0,0 +1,216 @@
+// Package roundtrip smoke-tests an endpoint: it uploads generated data,
+// reads it back and compares, timing every step.
+package roundtrip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/datagen"
+	"github.com/vskurikhin/awsfiles/internal/object"
+	"github.com/vskurikhin/awsfiles/internal/sizedist"
+	"github.com/vskurikhin/awsfiles/internal/upload"
+)
+
+// The steps of a round trip.
+const (
+	StepUpload = "upload"
+	StepWait   = "wait"
+	StepHead   = "head"
+	StepGet    = "get"
+	StepDelete = "delete"
+)
+
+// Step is the outcome of one step.
+type Step struct {
+	Name    string        `json:"name"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+	Err     string        `json:"error,omitempty"`
+}
+
+// Report is the outcome of a round trip.
+type Report struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	Seed   int64  `json:"seed"`
+	Steps  []Step `json:"steps"`
+	Pass   bool   `json:"pass"`
+}
+
+// errFailed is returned when a step fails, the step itself is reported.
+var errFailed = errors.New("round trip failed")
+
+// Roundtrip uploads cfg.Size bytes of cfg.DataPattern to cfg.Bucket/cfg.Key,
+// or a key of its own, waits for the object, checks its size and ETag with
+// HEAD, reads it back comparing the checksums and with cfg.Delete deletes
+// it. The error tells callers whether it passed.
+func Roundtrip(cfg config.Config) error {
+	r := roundtrip{cfg: cfg, s3Client: client.New(cfg), report: Report{Bucket: cfg.Bucket, Key: cfg.Key, Seed: cfg.Seed}}
+	if r.report.Key == "" {
+		r.report.Key = fmt.Sprintf("awsfiles-roundtrip-%d", time.Now().UnixNano())
+	}
+	if r.report.Seed == 0 {
+		r.report.Seed = time.Now().UnixNano()
+	}
+	r.cfg.Key = r.report.Key
+	r.run(context.Background())
+	if err := r.print(); err != nil {
+		return err
+	}
+	if !r.report.Pass {
+		return errFailed
+	}
+	return nil
+}
+
+type roundtrip struct {
+	cfg      config.Config
+	s3Client *s3.Client
+	report   Report
+	uploaded upload.Result
+}
+
+// run takes the steps up to the first failure, deleting what was uploaded
+// even then.
+func (r *roundtrip) run(ctx context.Context) {
+	ok := r.step(StepUpload, func() error { return r.upload(ctx) })
+	uploaded := ok
+	ok = ok && r.step(StepWait, func() error { return r.wait(ctx) })
+	ok = ok && r.step(StepHead, func() error { return r.head(ctx) })
+	ok = ok && r.step(StepGet, func() error { return r.get(ctx) })
+	if uploaded && r.cfg.Delete {
+		ok = r.step(StepDelete, func() error { return r.delete(ctx) }) && ok
+	}
+	r.report.Pass = ok
+}
+
+// step times fn, reports whether it succeeded and records it.
+func (r *roundtrip) step(name string, fn func() error) bool {
+	start := time.Now()
+	err := fn()
+	s := Step{Name: name, Elapsed: time.Since(start)}
+	if err != nil {
+		s.Err = err.Error()
+	}
+	r.report.Steps = append(r.report.Steps, s)
+	return err == nil
+}
+
+func (r *roundtrip) upload(ctx context.Context) error {
+	dist, err := sizedist.Parse(r.cfg.Size)
+	if err != nil {
+		return err
+	}
+	gen, err := datagen.Parse(r.cfg.DataPattern)
+	if err != nil {
+		return err
+	}
+	r.report.Size = dist.Next(rand.New(rand.NewSource(r.report.Seed)))
+	data, err := gen.New(r.report.Seed)
+	if err != nil {
+		return err
+	}
+	r.uploaded, err = upload.PutObject(ctx, r.cfg, r.s3Client, &s3.PutObjectInput{
+		Bucket:   aws.String(r.report.Bucket),
+		Key:      aws.String(r.report.Key),
+		Body:     io.LimitReader(data, r.report.Size),
+		Metadata: datagen.Metadata(gen, r.report.Seed),
+	}, r.report.Size)
+	if err != nil {
+		return err
+	}
+	if r.uploaded.Bytes != r.report.Size {
+		return fmt.Errorf("uploaded %d bytes, not %d", r.uploaded.Bytes, r.report.Size)
+	}
+	return nil
+}
+
+func (r *roundtrip) wait(ctx context.Context) error {
+	return s3.NewObjectExistsWaiter(r.s3Client).Wait(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(r.report.Bucket),
+		Key:    aws.String(r.report.Key),
+	}, r.cfg.Wait)
+}
+
+// head checks the size and, unless the server encrypts with a key of its
+// own, the ETag.
+func (r *roundtrip) head(ctx context.Context) error {
+	stat, err := object.Head(ctx, r.s3Client, r.report.Bucket, r.report.Key)
+	if err != nil {
+		return err
+	}
+	if stat.ContentLength != r.report.Size {
+		return fmt.Errorf("size %d, uploaded %d", stat.ContentLength, r.report.Size)
+	}
+	encrypted := stat.ServerSideEncryption == string(types.ServerSideEncryptionAwsKms) || stat.SSECustomerAlgorithm != ""
+	if !encrypted && !r.uploaded.ETag.Matches(stat.ETag) {
+		return fmt.Errorf("etag %s, uploaded %s", stat.ETag, r.uploaded.ETag.ETag())
+	}
+	return nil
+}
+
+// get reads the object back, comparing its checksums with the upload's
+// and the server's.
+func (r *roundtrip) get(ctx context.Context) error {
+	n, sums, header, err := object.Fetch(ctx, r.cfg, r.s3Client)
+	if err != nil {
+		return err
+	}
+	if n != r.report.Size {
+		return fmt.Errorf("read %d bytes, uploaded %d", n, r.report.Size)
+	}
+	for _, name := range sums.Names() {
+		if got, sent := sums.Hex(name), r.uploaded.Checksums.Hex(name); got != sent {
+			return fmt.Errorf("%s %s, uploaded %s", name, got, sent)
+		}
+	}
+	_, _, err = checksum.Compare(sums, checksum.FromHeader(header))
+	return err
+}
+
+func (r *roundtrip) delete(ctx context.Context) error {
+	_, err := r.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(r.report.Bucket),
+		Key:    aws.String(r.report.Key),
+	})
+	return err
+}
+
+func (r *roundtrip) print() error {
+	if r.cfg.Format == config.FormatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r.report)
+	}
+	slog.Info("Roundtrip", "result", fmt.Sprintf("s3://%s/%s, %d bytes, seed %d", r.report.Bucket, r.report.Key, r.report.Size, r.report.Seed))
+	var total time.Duration
+	for _, s := range r.report.Steps {
+		total += s.Elapsed
+		if s.Err != "" {
+			slog.Error("Roundtrip", "step", s.Name, "elapsed", s.Elapsed.Round(time.Millisecond), "err", s.Err)
+		} else {
+			slog.Info("Roundtrip", "step", s.Name, "elapsed", s.Elapsed.Round(time.Millisecond))
+		}
+	}
+	result := "PASS"
+	if !r.report.Pass {
+		result = "FAIL"
+	}
+	slog.Info("Roundtrip", "result", fmt.Sprintf("%s in %s", result, total.Round(time.Millisecond)))
+	return nil
+}
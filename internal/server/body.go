@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+)
+
+const (
+	checksumHeaderPrefix = "X-Amz-Checksum-"
+	headerChecksumAlg    = "X-Amz-Checksum-Algorithm"
+	headerSDKChecksumAlg = "X-Amz-Sdk-Checksum-Algorithm"
+)
+
+// checksumNames are the additional checksums S3 keeps.
+var checksumNames = []string{checksum.CRC32, checksum.CRC32C, checksum.SHA1, checksum.SHA256, checksum.CRC64NVME}
+
+// body reads the data of a PUT, hashing it to seal the object: the MD5 of
+// the ETag, and the checks of Content-MD5, x-amz-content-sha256 and the
+// additional checksums, sent as headers or aws-chunked trailers.
+type body struct {
+	r          io.Reader
+	chunked    *chunkedReader
+	sums       *checksum.Set
+	payload    string // hex SHA-256 to check, or ""
+	contentMD5 string
+	// algorithms are the additional checksums to keep.
+	algorithms []string
+	header     http.Header
+}
+
+// newBody decodes the body of r, keeping the checksums of the algorithm
+// besides those sent.
+func newBody(r *http.Request, sig *signature, algorithm string) *body {
+	b := &body{r: r.Body, contentMD5: r.Header.Get("Content-Md5"), header: r.Header}
+	if strings.HasPrefix(sig.payload, streamingPrefix) || strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		b.chunked = newChunkedReader(r.Body, sig)
+		b.r = b.chunked
+	} else if sig.payload != unsignedPayload && sig.payload != "" {
+		b.payload = sig.payload
+	}
+	names := []string{checksum.MD5}
+	if b.payload != "" {
+		names = append(names, checksum.SHA256)
+	}
+	algorithms := []string{algorithm, r.Header.Get(headerChecksumAlg), r.Header.Get(headerSDKChecksumAlg)}
+	for _, name := range strings.Split(r.Header.Get("X-Amz-Trailer"), ",") {
+		algorithms = append(algorithms, strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "x-amz-checksum-"))
+	}
+	for _, name := range checksumNames {
+		if r.Header.Get(checksumHeaderPrefix+name) != "" {
+			algorithms = append(algorithms, name)
+		}
+	}
+	for _, name := range algorithms {
+		name = strings.ToLower(name)
+		if checksum.Validate([]string{name}) == nil && name != checksum.MD5 && name != checksum.SHA512 && !slices.Contains(b.algorithms, name) {
+			b.algorithms = append(b.algorithms, name)
+		}
+	}
+	b.sums = checksum.New(append(names, b.algorithms...)...)
+	return b
+}
+
+// plainBody hashes a body read from the store, for copies.
+func plainBody(r io.Reader, algorithms []string) *body {
+	return &body{r: r, algorithms: algorithms, sums: checksum.New(append([]string{checksum.MD5}, algorithms...)...)}
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	_, _ = b.sums.Write(p[:n])
+	return n, err
+}
+
+// seal checks the hashes sent against the data and sets the ETag and the
+// checksums of the object.
+func (b *body) seal(o *Object) error {
+	// Older SDKs send the hash of the payload in base64 when it is the
+	// additional checksum too, S3 takes it.
+	if b.payload != "" && b.payload != b.sums.Hex(checksum.SHA256) && b.payload != b.sums.Base64(checksum.SHA256) {
+		return ErrSHA256Mismatch
+	}
+	if b.contentMD5 != "" && b.contentMD5 != b.sums.Base64(checksum.MD5) {
+		return ErrBadDigest
+	}
+	o.ETag = b.sums.Hex(checksum.MD5)
+	o.Checksums = nil
+	for _, name := range b.algorithms {
+		value := b.sums.Base64(name)
+		if sent := b.sent(name); sent != "" && sent != value {
+			return ErrBadDigest
+		}
+		if o.Checksums == nil {
+			o.Checksums = make(map[string]string)
+		}
+		o.Checksums[name] = value
+	}
+	return nil
+}
+
+// sent returns the checksum the client sent in a header or trailer.
+func (b *body) sent(name string) string {
+	if b.chunked != nil {
+		if v := b.chunked.trailer.Get(checksumHeaderPrefix + name); v != "" {
+			return v
+		}
+	}
+	if b.header != nil {
+		return b.header.Get(checksumHeaderPrefix + name)
+	}
+	return ""
+}
+
+// setChecksumHeaders adds the checksums of the object as response headers.
+func setChecksumHeaders(h http.Header, checksums map[string]string) {
+	for name, value := range checksums {
+		h.Set(checksumHeaderPrefix+name, value)
+	}
+}
+
+// compositeChecksum is the checksum of a multipart upload, of the part
+// checksums, "<base64>-<parts>".
+func compositeChecksum(name string, parts []string) (string, bool) {
+	sums := checksum.New(name)
+	for _, part := range parts {
+		raw, err := base64.StdEncoding.DecodeString(part)
+		if err != nil || part == "" {
+			return "", false
+		}
+		_, _ = sums.Write(raw)
+	}
+	return sums.Base64(name) + "-" + strconv.Itoa(len(parts)), true
+}
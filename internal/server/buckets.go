@@ -0,0 +1,328 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+	// maxListKeys is the most entries of a listing page.
+	maxListKeys = 1000
+	timeFormat  = "2006-01-02T15:04:05.000Z"
+)
+
+var bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// unsupported are the subresources the server does not implement.
+var unsupported = []string{
+	"accelerate", "acl", "analytics", "attributes", "intelligent-tiering", "inventory",
+	"legal-hold", "logging", "metrics", "notification", "ownershipControls",
+	"publicAccessBlock", "replication", "requestPayment", "restore", "retention",
+	"select", "torrent", "versions", "website",
+}
+
+func hasUnsupported(q url.Values) bool {
+	for _, name := range unsupported {
+		if q.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	q := r.URL.Query()
+	if hasUnsupported(q) {
+		writeError(w, r, ErrNotImplemented)
+		return
+	}
+	for subresource, e := range notConfigured {
+		if q.Has(subresource) {
+			if err := s.store.StatBucket(bucket); err != nil {
+				writeError(w, r, err)
+			} else if r.Method == http.MethodGet {
+				writeError(w, r, e)
+			} else {
+				writeError(w, r, ErrNotImplemented)
+			}
+			return
+		}
+	}
+	switch {
+	case r.Method == http.MethodPut && q.Has("versioning"):
+		writeError(w, r, ErrNotImplemented)
+	case r.Method == http.MethodPut:
+		s.createBucket(w, r, bucket)
+	case r.Method == http.MethodDelete:
+		if err := s.store.DeleteBucket(bucket); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodHead:
+		if err := s.store.StatBucket(bucket); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("X-Amz-Bucket-Region", s.opts.Region)
+	case r.Method == http.MethodGet && q.Has("location"):
+		s.getLocation(w, r, bucket)
+	case r.Method == http.MethodGet && q.Has("versioning"):
+		if err := s.store.StatBucket(bucket); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeXML(w, http.StatusOK, versioningConfiguration{})
+	case r.Method == http.MethodGet && q.Has("uploads"):
+		s.listUploads(w, r, bucket)
+	case r.Method == http.MethodGet:
+		s.listObjects(w, r, bucket)
+	case r.Method == http.MethodPost && q.Has("delete"):
+		s.deleteObjects(w, r, bucket)
+	default:
+		writeError(w, r, ErrNotImplemented)
+	}
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Owner   owner    `xml:"Owner"`
+	Buckets []bucket `xml:"Buckets>Bucket"`
+}
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+func (s *Server) listBuckets(w http.ResponseWriter, r *http.Request) {
+	buckets, err := s.store.Buckets()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	res := listAllMyBucketsResult{Xmlns: s3Namespace, Owner: s.owner()}
+	for _, b := range buckets {
+		res.Buckets = append(res.Buckets, bucket{Name: b.Name, CreationDate: b.Created.Format(timeFormat)})
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+func (s *Server) owner() owner {
+	return owner{ID: "awsfiles", DisplayName: "awsfiles"}
+}
+
+func (s *Server) createBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	if !bucketName.MatchString(bucket) || strings.Contains(bucket, "..") {
+		writeError(w, r, ErrInvalidBucketName)
+		return
+	}
+	if err := s.store.CreateBucket(bucket); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/"+bucket)
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Value   string   `xml:",chardata"`
+}
+
+func (s *Server) getLocation(w http.ResponseWriter, r *http.Request, bucket string) {
+	if err := s.store.StatBucket(bucket); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	res := locationConstraint{Xmlns: s3Namespace}
+	if s.opts.Region != defaultRegion {
+		res.Value = s.opts.Region
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"VersioningConfiguration"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Marker                *string        `xml:"Marker"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	KeyCount              *int           `xml:"KeyCount"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []listEntry    `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type listEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listObjects answers ListObjectsV2 and, without list-type=2, ListObjects.
+// The continuation token is the last key or common prefix returned.
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	q := r.URL.Query()
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	v2 := q.Get("list-type") == "2"
+	maxKeys := maxListKeys
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, r, ErrInvalidArgument)
+			return
+		}
+		maxKeys = min(n, maxListKeys)
+	}
+	res := listBucketResult{Xmlns: s3Namespace, Name: bucket, MaxKeys: maxKeys, Delimiter: delimiter}
+	after := q.Get("marker")
+	if v2 {
+		after = q.Get("start-after")
+		res.StartAfter = after
+		if token := q.Get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				writeError(w, r, ErrInvalidArgument)
+				return
+			}
+			after, res.ContinuationToken = string(decoded), token
+		}
+	} else {
+		res.Marker = &after
+	}
+	objects, err := s.store.List(bucket, prefix)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	encode := func(s string) string { return s }
+	if q.Get("encoding-type") == "url" {
+		res.EncodingType = "url"
+		encode = func(s string) string { return awsEscape(s, false) }
+	}
+	res.Prefix = encode(prefix)
+	var last string
+	count := 0
+	for _, o := range objects {
+		entry := o.Key
+		if delimiter != "" {
+			if i := strings.Index(o.Key[len(prefix):], delimiter); i >= 0 {
+				entry = o.Key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if entry <= after || entry == last {
+			continue
+		}
+		if count == maxKeys {
+			res.IsTruncated = true
+			break
+		}
+		if entry == o.Key {
+			res.Contents = append(res.Contents, listEntry{
+				Key:          encode(o.Key),
+				LastModified: o.LastModified.Format(timeFormat),
+				ETag:         quote(o.ETag),
+				Size:         o.Size,
+				StorageClass: "STANDARD",
+			})
+		} else {
+			res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: encode(entry)})
+		}
+		last = entry
+		count++
+	}
+	if v2 {
+		res.KeyCount = &count
+		if res.IsTruncated {
+			res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+		}
+	} else if res.IsTruncated {
+		res.NextMarker = encode(last)
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+type deleteRequest struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name      `xml:"DeleteResult"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Deleted []deleted     `xml:"Deleted"`
+	Errors  []deleteError `xml:"Error"`
+}
+
+type deleted struct {
+	Key string `xml:"Key"`
+}
+
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	var req deleteRequest
+	if err := xml.NewDecoder(http.MaxBytesReader(w, r.Body, 2<<20)).Decode(&req); err != nil {
+		writeError(w, r, ErrMalformedXML)
+		return
+	}
+	if err := s.store.StatBucket(bucket); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	res := deleteResult{Xmlns: s3Namespace}
+	for _, o := range req.Objects {
+		if err := s.store.Delete(bucket, o.Key); err != nil {
+			e := asError(err)
+			res.Errors = append(res.Errors, deleteError{Key: o.Key, Code: e.Code, Message: e.Message})
+		} else if !req.Quiet {
+			res.Deleted = append(res.Deleted, deleted{Key: o.Key})
+		}
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+func quote(etag string) string {
+	return `"` + etag + `"`
+}
+
+func httpTime(t time.Time) string {
+	return t.UTC().Format(http.TimeFormat)
+}
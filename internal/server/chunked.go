@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxChunkLine bounds the chunk header and trailer lines.
+const maxChunkLine = 4096
+
+var errChunkFormat = &Error{http.StatusBadRequest, "IncompleteBody", "The aws-chunked body is malformed"}
+
+// chunkedReader decodes an aws-chunked body,
+//
+//	<hex size>[;chunk-signature=<signature>]\r\n<data>\r\n ... 0...\r\n<trailers>\r\n
+//
+// verifying the chunk signatures when sig is given. The trailers, where
+// SDKs send the additional checksums, are read into trailer.
+type chunkedReader struct {
+	r         *bufio.Reader
+	sig       *signature
+	previous  string // signature of the previous chunk
+	expected  string // signature of the current chunk
+	hash      hash.Hash
+	remaining int64
+	started   bool
+	done      bool
+	trailer   http.Header
+}
+
+func newChunkedReader(body io.Reader, sig *signature) *chunkedReader {
+	c := &chunkedReader{r: bufio.NewReader(body), trailer: make(http.Header)}
+	if sig != nil && sig.key != nil && strings.HasPrefix(sig.payload, streamingSignedPrefix) {
+		c.sig, c.previous, c.hash = sig, sig.value, sha256.New()
+	}
+	return c
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.hash != nil {
+		c.hash.Write(p[:n])
+	}
+	if errors.Is(err, io.EOF) {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// next ends the current chunk and starts the next, reading the trailers
+// after the last.
+func (c *chunkedReader) next() error {
+	if c.started {
+		if line, err := c.line(); err != nil || line != "" {
+			return errChunkFormat
+		}
+		if err := c.verify(); err != nil {
+			return err
+		}
+	}
+	c.started = true
+	line, err := c.line()
+	if err != nil {
+		return errChunkFormat
+	}
+	size, ext, _ := strings.Cut(line, ";")
+	if c.remaining, err = strconv.ParseInt(size, 16, 64); err != nil || c.remaining < 0 {
+		return errChunkFormat
+	}
+	c.expected = strings.TrimPrefix(ext, "chunk-signature=")
+	if c.remaining > 0 {
+		return nil
+	}
+	if err = c.verify(); err != nil {
+		return err
+	}
+	c.done = true
+	for {
+		line, err = c.line()
+		if err == io.EOF || err == nil && line == "" {
+			return nil
+		} else if err != nil {
+			return errChunkFormat
+		}
+		name, value, _ := strings.Cut(line, ":")
+		c.trailer.Add(name, strings.TrimSpace(value))
+	}
+}
+
+func (c *chunkedReader) verify() error {
+	if c.sig == nil {
+		return nil
+	}
+	value := c.sig.chunkSignature(c.previous, hex.EncodeToString(c.hash.Sum(nil)))
+	if !hmac.Equal([]byte(value), []byte(c.expected)) {
+		return ErrSignatureDoesNotMatch
+	}
+	c.previous = value
+	c.hash.Reset()
+	return nil
+}
+
+// line reads a line without the \r\n.
+func (c *chunkedReader) line() (string, error) {
+	var b strings.Builder
+	for {
+		part, isPrefix, err := c.r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		b.Write(part)
+		if b.Len() > maxChunkLine {
+			return "", errChunkFormat
+		}
+		if !isPrefix {
+			return b.String(), nil
+		}
+	}
+}
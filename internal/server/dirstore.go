@@ -0,0 +1,321 @@
+package server
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metaDir holds the metadata, staging files and parts of a DirStore. It
+// is no valid bucket name.
+const metaDir = ".awsfiles"
+
+// errInvalidKey is a key that can not be a file path.
+var errInvalidKey = &Error{http.StatusBadRequest, "InvalidArgument", "The key can not be stored as a file of the directory"}
+
+var _ Store = (*DirStore)(nil)
+
+// DirStore keeps the objects as files root/<bucket>/<key>, so they can be
+// looked at or put in place by hand, and their metadata as JSON under
+// root/.awsfiles/meta. Files without metadata get their ETag computed.
+type DirStore struct {
+	root string
+}
+
+// NewDirStore creates root if needed and clears the staging files and
+// parts of an earlier run.
+func NewDirStore(root string) (*DirStore, error) {
+	s := &DirStore{root: root}
+	for _, dir := range []string{s.tmpDir(), s.partsDir()} {
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *DirStore) tmpDir() string   { return filepath.Join(s.root, metaDir, "tmp") }
+func (s *DirStore) partsDir() string { return filepath.Join(s.root, metaDir, "parts") }
+
+func (s *DirStore) bucketPath(bucket string) string {
+	return filepath.Join(s.root, bucket)
+}
+
+// objectPath returns the file of the key, which must be a clean relative
+// path.
+func (s *DirStore) objectPath(bucket, key string) (string, error) {
+	if key == "" || strings.HasSuffix(key, "/") || strings.Contains(key, "\\") {
+		return "", errInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", errInvalidKey
+		}
+	}
+	return filepath.Join(s.bucketPath(bucket), filepath.FromSlash(key)), nil
+}
+
+func (s *DirStore) metaPath(bucket, key string) string {
+	return filepath.Join(s.root, metaDir, "meta", bucket, filepath.FromSlash(key)+".json")
+}
+
+func (s *DirStore) CreateBucket(name string) error {
+	err := os.Mkdir(s.bucketPath(name), 0o755)
+	if errors.Is(err, fs.ErrExist) {
+		return ErrBucketAlreadyExists
+	}
+	return err
+}
+
+func (s *DirStore) DeleteBucket(name string) error {
+	if err := s.StatBucket(name); err != nil {
+		return err
+	}
+	objects, err := s.List(name, "")
+	if err != nil {
+		return err
+	}
+	if len(objects) > 0 {
+		return ErrBucketNotEmpty
+	}
+	if err = os.RemoveAll(filepath.Join(s.root, metaDir, "meta", name)); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.bucketPath(name))
+}
+
+func (s *DirStore) Buckets() ([]Bucket, error) {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return nil, err
+	}
+	var buckets []Bucket
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == metaDir {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, Bucket{Name: e.Name(), Created: info.ModTime().UTC()})
+	}
+	return buckets, nil
+}
+
+func (s *DirStore) StatBucket(name string) error {
+	info, err := os.Stat(s.bucketPath(name))
+	if err != nil || !info.IsDir() || name == metaDir {
+		return ErrNoSuchBucket
+	}
+	return nil
+}
+
+func (s *DirStore) Put(bucket, key string, body io.Reader, seal func(*Object) error) (Object, error) {
+	if err := s.StatBucket(bucket); err != nil {
+		return Object{}, err
+	}
+	p, err := s.objectPath(bucket, key)
+	if err != nil {
+		return Object{}, err
+	}
+	tmp, o, err := s.stage(key, body, seal)
+	if err != nil {
+		return Object{}, err
+	}
+	defer func() { _ = os.Remove(tmp) }()
+	if err = os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return Object{}, errInvalidKey
+	}
+	if err = os.Rename(tmp, p); err != nil {
+		return Object{}, errInvalidKey
+	}
+	_ = os.Chtimes(p, o.LastModified, o.LastModified)
+	return o, s.writeMeta(s.metaPath(bucket, key), o)
+}
+
+// stage writes the body to a file of the staging directory and seals it.
+func (s *DirStore) stage(key string, body io.Reader, seal func(*Object) error) (string, Object, error) {
+	f, err := os.CreateTemp(s.tmpDir(), "put-*")
+	if err != nil {
+		return "", Object{}, err
+	}
+	n, err := io.Copy(f, body)
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	o := Object{Key: key, Size: n, LastModified: time.Now().UTC().Truncate(time.Second)}
+	if err == nil {
+		err = seal(&o)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", Object{}, err
+	}
+	return f.Name(), o, nil
+}
+
+func (s *DirStore) writeMeta(p string, o Object) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+func (s *DirStore) Open(bucket, key string) (Object, io.ReadSeekCloser, error) {
+	o, err := s.Stat(bucket, key)
+	if err != nil {
+		return Object{}, nil, err
+	}
+	p, _ := s.objectPath(bucket, key)
+	f, err := os.Open(p)
+	if err != nil {
+		return Object{}, nil, ErrNoSuchKey
+	}
+	return o, f, nil
+}
+
+// Stat reads the metadata of the object, or makes it up from the file.
+func (s *DirStore) Stat(bucket, key string) (Object, error) {
+	if err := s.StatBucket(bucket); err != nil {
+		return Object{}, err
+	}
+	p, err := s.objectPath(bucket, key)
+	if err != nil {
+		return Object{}, ErrNoSuchKey
+	}
+	info, err := os.Stat(p)
+	if err != nil || !info.Mode().IsRegular() {
+		return Object{}, ErrNoSuchKey
+	}
+	var o Object
+	if data, err := os.ReadFile(s.metaPath(bucket, key)); err == nil && json.Unmarshal(data, &o) == nil && o.Size == info.Size() {
+		return o, nil
+	}
+	sum, err := md5File(p)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Key: key, Size: info.Size(), ETag: sum, LastModified: info.ModTime().UTC()}, nil
+}
+
+func md5File(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := md5.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Delete removes the file and its metadata, and the directories left
+// empty up to the bucket.
+func (s *DirStore) Delete(bucket, key string) error {
+	if err := s.StatBucket(bucket); err != nil {
+		return err
+	}
+	p, err := s.objectPath(bucket, key)
+	if err != nil {
+		return nil
+	}
+	if err = os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	_ = os.Remove(s.metaPath(bucket, key))
+	dir := filepath.Dir(p)
+	for dir != s.bucketPath(bucket) && os.Remove(dir) == nil {
+		dir = filepath.Dir(dir)
+	}
+	return nil
+}
+
+func (s *DirStore) List(bucket, prefix string) ([]Object, error) {
+	if err := s.StatBucket(bucket); err != nil {
+		return nil, err
+	}
+	base := s.bucketPath(bucket)
+	// Walk only the directory the prefix is in.
+	start := filepath.Join(base, filepath.FromSlash(path.Dir("/"+prefix)))
+	var objects []Object
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		o, err := s.Stat(bucket, key)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, o)
+		return nil
+	})
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, err
+}
+
+func (s *DirStore) partPath(upload string, part int32) string {
+	return filepath.Join(s.partsDir(), upload, strconv.Itoa(int(part)))
+}
+
+func (s *DirStore) PutPart(upload string, part int32, body io.Reader, seal func(*Object) error) (Object, error) {
+	tmp, o, err := s.stage("", body, seal)
+	if err != nil {
+		return Object{}, err
+	}
+	defer func() { _ = os.Remove(tmp) }()
+	p := s.partPath(upload, part)
+	if err = os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return Object{}, err
+	}
+	return o, os.Rename(tmp, p)
+}
+
+func (s *DirStore) OpenPart(upload string, part int32) (io.ReadCloser, error) {
+	f, err := os.Open(s.partPath(upload, part))
+	if err != nil {
+		return nil, ErrInvalidPart
+	}
+	return f, nil
+}
+
+func (s *DirStore) DeleteParts(upload string) error {
+	return os.RemoveAll(filepath.Join(s.partsDir(), upload))
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// Error is an S3 error response.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// The S3 errors the server returns.
+var (
+	ErrAccessDenied          = &Error{http.StatusForbidden, "AccessDenied", "Access Denied"}
+	ErrBadDigest             = &Error{http.StatusBadRequest, "BadDigest", "The Content-MD5 or checksum you specified did not match what we received"}
+	ErrBucketAlreadyExists   = &Error{http.StatusConflict, "BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it"}
+	ErrBucketNotEmpty        = &Error{http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty"}
+	ErrEntityTooSmall        = &Error{http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size"}
+	ErrExpiredToken          = &Error{http.StatusForbidden, "AccessDenied", "Request has expired"}
+	ErrInvalidAccessKeyID    = &Error{http.StatusForbidden, "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records"}
+	ErrInvalidArgument       = &Error{http.StatusBadRequest, "InvalidArgument", "Invalid Argument"}
+	ErrInvalidBucketName     = &Error{http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid"}
+	ErrInvalidPart           = &Error{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found"}
+	ErrInvalidPartOrder      = &Error{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order"}
+	ErrInvalidRange          = &Error{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable"}
+	ErrInvalidRequest        = &Error{http.StatusBadRequest, "InvalidRequest", "Invalid Request"}
+	ErrInternal              = &Error{http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again."}
+	ErrMalformedXML          = &Error{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed"}
+	ErrMethodNotAllowed      = &Error{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource"}
+	ErrMissingSecurityHeader = &Error{http.StatusBadRequest, "MissingSecurityHeader", "Your request was missing a required header"}
+	ErrNoSuchBucket          = &Error{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist"}
+	ErrNoSuchKey             = &Error{http.StatusNotFound, "NoSuchKey", "The specified key does not exist"}
+	ErrNoSuchUpload          = &Error{http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist"}
+	ErrNotImplemented        = &Error{http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented"}
+	ErrPreconditionFailed    = &Error{http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the preconditions you specified did not hold"}
+	ErrRequestTimeTooSkewed  = &Error{http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large"}
+	ErrSHA256Mismatch        = &Error{http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed"}
+	ErrSignatureDoesNotMatch = &Error{http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided"}
+)
+
+// notConfigured are the errors of the bucket configurations the server
+// keeps none of, by subresource.
+var notConfigured = map[string]*Error{
+	"cors":        {http.StatusNotFound, "NoSuchCORSConfiguration", "The CORS configuration does not exist"},
+	"encryption":  {http.StatusNotFound, "ServerSideEncryptionConfigurationNotFoundError", "The server side encryption configuration was not found"},
+	"lifecycle":   {http.StatusNotFound, "NoSuchLifecycleConfiguration", "The lifecycle configuration does not exist"},
+	"object-lock": {http.StatusNotFound, "ObjectLockConfigurationNotFoundError", "Object Lock configuration does not exist for this bucket"},
+	"policy":      {http.StatusNotFound, "NoSuchBucketPolicy", "The bucket policy does not exist"},
+	"tagging":     {http.StatusNotFound, "NoSuchTagSet", "The TagSet does not exist"},
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource,omitempty"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// asError returns err as an S3 error, an internal error unless it is an
+// *Error.
+func asError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	slog.Error("Serve failed", "err", err)
+	return ErrInternal
+}
+
+// writeError writes err as an S3 error. HEAD responses have no body.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e := asError(err)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(e.Status)
+		return
+	}
+	writeXML(w, e.Status, errorResponse{
+		Code:      e.Code,
+		Message:   e.Message,
+		Resource:  r.URL.Path,
+		RequestID: w.Header().Get(headerRequestID),
+	})
+}
+
+// writeXML writes v as the XML body of the response.
+func writeXML(w http.ResponseWriter, status int, v any) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		slog.Error("Serve failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(body)
+}
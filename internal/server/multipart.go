@@ -0,0 +1,467 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+	"github.com/vskurikhin/awsfiles/internal/etag"
+)
+
+// maxPartNumber is the S3 limit of parts of a multipart upload.
+const maxPartNumber = 10000
+
+// upload is an incomplete multipart upload. Uploads are kept in memory,
+// a restart forgets them.
+type upload struct {
+	id        string
+	bucket    string
+	key       string
+	initiated time.Time
+	attrs     attributes
+	algorithm string
+	parts     map[int32]Object
+}
+
+// checksums are the checksum elements of the multipart XML.
+type checksums struct {
+	ChecksumCRC32     string `xml:"ChecksumCRC32,omitempty"`
+	ChecksumCRC32C    string `xml:"ChecksumCRC32C,omitempty"`
+	ChecksumCRC64NVME string `xml:"ChecksumCRC64NVME,omitempty"`
+	ChecksumSHA1      string `xml:"ChecksumSHA1,omitempty"`
+	ChecksumSHA256    string `xml:"ChecksumSHA256,omitempty"`
+}
+
+func checksumsOf(m map[string]string) checksums {
+	return checksums{
+		ChecksumCRC32:     m[checksum.CRC32],
+		ChecksumCRC32C:    m[checksum.CRC32C],
+		ChecksumCRC64NVME: m[checksum.CRC64NVME],
+		ChecksumSHA1:      m[checksum.SHA1],
+		ChecksumSHA256:    m[checksum.SHA256],
+	}
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+func (s *Server) createUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	if err := s.store.StatBucket(bucket); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	algorithm := strings.ToLower(r.Header.Get(headerChecksumAlg))
+	if algorithm != "" && !slices.Contains(checksumNames, algorithm) {
+		writeError(w, r, ErrInvalidArgument)
+		return
+	}
+	u := &upload{
+		id:        newID(16),
+		bucket:    bucket,
+		key:       key,
+		initiated: time.Now().UTC(),
+		attrs:     attributesOf(r.Header),
+		algorithm: algorithm,
+		parts:     make(map[int32]Object),
+	}
+	s.mu.Lock()
+	s.uploads[u.id] = u
+	s.mu.Unlock()
+	if algorithm != "" {
+		w.Header().Set(headerChecksumAlg, strings.ToUpper(algorithm))
+	}
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadID: u.id})
+}
+
+// getUpload returns the upload of the request, with a copy of its parts.
+func (s *Server) getUpload(r *http.Request, bucket, key string) (upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[r.URL.Query().Get("uploadId")]
+	if !ok || u.bucket != bucket || u.key != key {
+		return upload{}, ErrNoSuchUpload
+	}
+	c := *u
+	c.parts = make(map[int32]Object, len(u.parts))
+	for n, o := range u.parts {
+		c.parts[n] = o
+	}
+	return c, nil
+}
+
+// addPart records the part, unless the upload ended meanwhile.
+func (s *Server) addPart(id string, n int32, o Object) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok {
+		return ErrNoSuchUpload
+	}
+	u.parts[n] = o
+	return nil
+}
+
+type copyPartResult struct {
+	XMLName      xml.Name `xml:"CopyPartResult"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+// uploadPart answers UploadPart and, with x-amz-copy-source,
+// UploadPartCopy.
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, sig *signature, bucket, key string) {
+	n, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || n < 1 || n > maxPartNumber {
+		writeError(w, r, ErrInvalidArgument)
+		return
+	}
+	u, err := s.getUpload(r, bucket, key)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var b *body
+	if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+		var rc io.ReadCloser
+		if rc, err = s.openCopyRange(r, source); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		defer func() { _ = rc.Close() }()
+		b = plainBody(rc, checksumAlgorithms(nil, u.algorithm))
+	} else {
+		b = newBody(r, sig, u.algorithm)
+	}
+	o, err := s.store.PutPart(u.id, int32(n), b, b.seal)
+	if err == nil {
+		err = s.addPart(u.id, int32(n), o)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		writeXML(w, http.StatusOK, copyPartResult{LastModified: o.LastModified.Format(timeFormat), ETag: quote(o.ETag)})
+		return
+	}
+	w.Header().Set("ETag", quote(o.ETag))
+	setChecksumHeaders(w.Header(), o.Checksums)
+}
+
+// openCopyRange opens the source of UploadPartCopy at
+// x-amz-copy-source-range, or whole.
+func (s *Server) openCopyRange(r *http.Request, source string) (io.ReadCloser, error) {
+	srcBucket, srcKey, err := copySource(source)
+	if err != nil {
+		return nil, err
+	}
+	src, rc, err := s.store.Open(srcBucket, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = copyConditions(r.Header, src); err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	start, length := int64(0), src.Size
+	if spec := r.Header.Get("X-Amz-Copy-Source-Range"); spec != "" {
+		var ok bool
+		if start, length, ok = parseRange(spec, src.Size); !ok {
+			_ = rc.Close()
+			return nil, ErrInvalidRange
+		}
+	}
+	if _, err = rc.Seek(start, io.SeekStart); err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, length), rc}, nil
+}
+
+type listPartsResult struct {
+	XMLName              xml.Name `xml:"ListPartsResult"`
+	Xmlns                string   `xml:"xmlns,attr"`
+	Bucket               string   `xml:"Bucket"`
+	Key                  string   `xml:"Key"`
+	UploadID             string   `xml:"UploadId"`
+	ChecksumAlgorithm    string   `xml:"ChecksumAlgorithm,omitempty"`
+	PartNumberMarker     int32    `xml:"PartNumberMarker"`
+	NextPartNumberMarker int32    `xml:"NextPartNumberMarker"`
+	MaxParts             int      `xml:"MaxParts"`
+	IsTruncated          bool     `xml:"IsTruncated"`
+	StorageClass         string   `xml:"StorageClass"`
+	Owner                owner    `xml:"Owner"`
+	Parts                []part   `xml:"Part"`
+}
+
+type part struct {
+	PartNumber   int32  `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	checksums
+}
+
+func (s *Server) listParts(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	u, err := s.getUpload(r, bucket, key)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	q := r.URL.Query()
+	marker, _ := strconv.Atoi(q.Get("part-number-marker"))
+	maxParts := maxListKeys
+	if v, err := strconv.Atoi(q.Get("max-parts")); err == nil && v >= 0 {
+		maxParts = min(v, maxListKeys)
+	}
+	res := listPartsResult{
+		Xmlns:             s3Namespace,
+		Bucket:            bucket,
+		Key:               key,
+		UploadID:          u.id,
+		ChecksumAlgorithm: strings.ToUpper(u.algorithm),
+		PartNumberMarker:  int32(marker),
+		MaxParts:          maxParts,
+		StorageClass:      "STANDARD",
+		Owner:             s.owner(),
+	}
+	for _, n := range sortedParts(u.parts) {
+		if n <= int32(marker) {
+			continue
+		}
+		if len(res.Parts) == maxParts {
+			res.IsTruncated = true
+			break
+		}
+		o := u.parts[n]
+		res.Parts = append(res.Parts, part{
+			PartNumber:   n,
+			LastModified: o.LastModified.Format(timeFormat),
+			ETag:         quote(o.ETag),
+			Size:         o.Size,
+			checksums:    checksumsOf(o.Checksums),
+		})
+		res.NextPartNumberMarker = n
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+func sortedParts(parts map[int32]Object) []int32 {
+	numbers := make([]int32, 0, len(parts))
+	for n := range parts {
+		numbers = append(numbers, n)
+	}
+	slices.Sort(numbers)
+	return numbers
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int32  `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+	checksums
+}
+
+// completeUpload joins the parts listed into the object, with the ETag
+// and the checksum of S3 multipart uploads, of the part MD5s and checksums.
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	u, err := s.getUpload(r, bucket, key)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req completeMultipartUpload
+	if err = xml.NewDecoder(http.MaxBytesReader(w, r.Body, 2<<20)).Decode(&req); err != nil || len(req.Parts) == 0 {
+		writeError(w, r, ErrMalformedXML)
+		return
+	}
+	numbers := make([]int32, 0, len(req.Parts))
+	var sums []byte
+	var partSums []string
+	for i, p := range req.Parts {
+		o, ok := u.parts[p.PartNumber]
+		if !ok || strings.Trim(p.ETag, `"`) != o.ETag {
+			writeError(w, r, ErrInvalidPart)
+			return
+		}
+		if i > 0 && p.PartNumber <= numbers[i-1] {
+			writeError(w, r, ErrInvalidPartOrder)
+			return
+		}
+		if i < len(req.Parts)-1 && o.Size < s.opts.MinPartSize {
+			writeError(w, r, ErrEntityTooSmall)
+			return
+		}
+		raw, _ := hex.DecodeString(o.ETag)
+		sums = append(sums, raw...)
+		partSums = append(partSums, o.Checksums[u.algorithm])
+		numbers = append(numbers, p.PartNumber)
+	}
+	tag := etag.Combine(sums, len(numbers))
+	var objectSums map[string]string
+	if u.algorithm != "" {
+		if value, ok := compositeChecksum(u.algorithm, partSums); ok {
+			objectSums = map[string]string{u.algorithm: value}
+		}
+	}
+	pr := &partsReader{store: s.store, upload: u.id, parts: numbers}
+	defer pr.close()
+	o, err := s.store.Put(bucket, key, pr, func(o *Object) error {
+		o.ETag, o.Checksums = tag, objectSums
+		u.attrs.apply(o)
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.endUpload(u.id)
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		Xmlns:     s3Namespace,
+		Location:  "/" + bucket + "/" + key,
+		Bucket:    bucket,
+		Key:       key,
+		ETag:      quote(o.ETag),
+		checksums: checksumsOf(o.Checksums),
+	})
+}
+
+func (s *Server) abortUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	u, err := s.getUpload(r, bucket, key)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.endUpload(u.id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) endUpload(id string) {
+	s.mu.Lock()
+	delete(s.uploads, id)
+	s.mu.Unlock()
+	if err := s.store.DeleteParts(id); err != nil {
+		slog.Error("Serve failed", "upload", id, "err", err)
+	}
+}
+
+type listMultipartUploadsResult struct {
+	XMLName        xml.Name      `xml:"ListMultipartUploadsResult"`
+	Xmlns          string        `xml:"xmlns,attr"`
+	Bucket         string        `xml:"Bucket"`
+	KeyMarker      string        `xml:"KeyMarker"`
+	UploadIDMarker string        `xml:"UploadIdMarker"`
+	Prefix         string        `xml:"Prefix"`
+	MaxUploads     int           `xml:"MaxUploads"`
+	IsTruncated    bool          `xml:"IsTruncated"`
+	Uploads        []uploadEntry `xml:"Upload"`
+}
+
+type uploadEntry struct {
+	Key          string `xml:"Key"`
+	UploadID     string `xml:"UploadId"`
+	Initiated    string `xml:"Initiated"`
+	StorageClass string `xml:"StorageClass"`
+	Owner        owner  `xml:"Owner"`
+	Initiator    owner  `xml:"Initiator"`
+}
+
+// listUploads lists the uploads of the bucket in one page.
+func (s *Server) listUploads(w http.ResponseWriter, r *http.Request, bucket string) {
+	if err := s.store.StatBucket(bucket); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+	res := listMultipartUploadsResult{Xmlns: s3Namespace, Bucket: bucket, Prefix: prefix, MaxUploads: maxListKeys}
+	var uploads []*upload
+	s.mu.Lock()
+	for _, u := range s.uploads {
+		if u.bucket == bucket && strings.HasPrefix(u.key, prefix) {
+			uploads = append(uploads, u)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].key != uploads[j].key {
+			return uploads[i].key < uploads[j].key
+		}
+		return uploads[i].initiated.Before(uploads[j].initiated)
+	})
+	for _, u := range uploads {
+		res.Uploads = append(res.Uploads, uploadEntry{
+			Key:          u.key,
+			UploadID:     u.id,
+			Initiated:    u.initiated.Format(timeFormat),
+			StorageClass: "STANDARD",
+			Owner:        s.owner(),
+			Initiator:    s.owner(),
+		})
+	}
+	writeXML(w, http.StatusOK, res)
+}
+
+// partsReader reads the parts one after the other, opening each in turn.
+type partsReader struct {
+	store  Store
+	upload string
+	parts  []int32
+	cur    io.ReadCloser
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.cur == nil {
+			if len(p.parts) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := p.store.OpenPart(p.upload, p.parts[0])
+			if err != nil {
+				return 0, err
+			}
+			p.cur, p.parts = rc, p.parts[1:]
+		}
+		n, err := p.cur.Read(b)
+		if err == io.EOF {
+			p.close()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) close() {
+	if p.cur != nil {
+		_ = p.cur.Close()
+		p.cur = nil
+	}
+}
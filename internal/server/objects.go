@@ -0,0 +1,362 @@
+package server
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const metaHeaderPrefix = "X-Amz-Meta-"
+
+// storedHeaders are the standard headers kept with an object besides
+// Content-Type.
+var storedHeaders = []string{"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Expires"}
+
+// responseOverrides are the query parameters of a GET overriding the
+// stored headers.
+var responseOverrides = map[string]string{
+	"response-cache-control":       "Cache-Control",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-encoding":    "Content-Encoding",
+	"response-content-language":    "Content-Language",
+	"response-content-type":        "Content-Type",
+	"response-expires":             "Expires",
+}
+
+// attributes are the headers and user metadata of an object.
+type attributes struct {
+	contentType string
+	headers     map[string]string
+	metadata    map[string]string
+}
+
+// attributesOf reads the attributes from the request headers. The
+// aws-chunked content encoding is the request's, not the object's.
+func attributesOf(h http.Header) attributes {
+	a := attributes{contentType: h.Get("Content-Type")}
+	for _, name := range storedHeaders {
+		v := h.Get(name)
+		if name == "Content-Encoding" {
+			var kept []string
+			for _, enc := range strings.Split(v, ",") {
+				if enc = strings.TrimSpace(enc); enc != "" && enc != "aws-chunked" {
+					kept = append(kept, enc)
+				}
+			}
+			v = strings.Join(kept, ",")
+		}
+		if v != "" {
+			if a.headers == nil {
+				a.headers = make(map[string]string)
+			}
+			a.headers[name] = v
+		}
+	}
+	for name, values := range h {
+		if strings.HasPrefix(name, metaHeaderPrefix) && len(values) > 0 {
+			if a.metadata == nil {
+				a.metadata = make(map[string]string)
+			}
+			a.metadata[strings.ToLower(strings.TrimPrefix(name, metaHeaderPrefix))] = values[0]
+		}
+	}
+	return a
+}
+
+func attributesOfObject(o Object) attributes {
+	return attributes{contentType: o.ContentType, headers: o.Headers, metadata: o.Metadata}
+}
+
+func (a attributes) apply(o *Object) {
+	o.ContentType, o.Headers, o.Metadata = a.contentType, a.headers, a.metadata
+}
+
+// sealWith seals the object with the body and sets its attributes.
+func sealWith(b *body, a attributes) func(*Object) error {
+	return func(o *Object) error {
+		if err := b.seal(o); err != nil {
+			return err
+		}
+		a.apply(o)
+		return nil
+	}
+}
+
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, sig *signature, bucket, key string) {
+	q := r.URL.Query()
+	if hasUnsupported(q) || q.Has("tagging") {
+		writeError(w, r, ErrNotImplemented)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		switch {
+		case q.Has("uploadId"):
+			s.uploadPart(w, r, sig, bucket, key)
+		case r.Header.Get("X-Amz-Copy-Source") != "":
+			s.copyObject(w, r, bucket, key)
+		default:
+			s.putObject(w, r, sig, bucket, key)
+		}
+	case http.MethodGet, http.MethodHead:
+		if q.Has("uploadId") && r.Method == http.MethodGet {
+			s.listParts(w, r, bucket, key)
+		} else {
+			s.getObject(w, r, bucket, key)
+		}
+	case http.MethodDelete:
+		if q.Has("uploadId") {
+			s.abortUpload(w, r, bucket, key)
+		} else if err := s.store.Delete(bucket, key); err != nil {
+			writeError(w, r, err)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case http.MethodPost:
+		switch {
+		case q.Has("uploads"):
+			s.createUpload(w, r, bucket, key)
+		case q.Has("uploadId"):
+			s.completeUpload(w, r, bucket, key)
+		default:
+			writeError(w, r, ErrNotImplemented)
+		}
+	default:
+		writeError(w, r, ErrMethodNotAllowed)
+	}
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, sig *signature, bucket, key string) {
+	if r.Header.Get("If-None-Match") == "*" {
+		if _, err := s.store.Stat(bucket, key); err == nil {
+			writeError(w, r, ErrPreconditionFailed)
+			return
+		}
+	}
+	b := newBody(r, sig, "")
+	o, err := s.store.Put(bucket, key, b, sealWith(b, attributesOf(r.Header)))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", quote(o.ETag))
+	setChecksumHeaders(w.Header(), o.Checksums)
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	srcBucket, srcKey, err := copySource(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	src, rc, err := s.store.Open(srcBucket, srcKey)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer func() { _ = rc.Close() }()
+	if err = copyConditions(r.Header, src); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	a := attributesOfObject(src)
+	if strings.EqualFold(r.Header.Get("X-Amz-Metadata-Directive"), "REPLACE") {
+		a = attributesOf(r.Header)
+	}
+	b := plainBody(rc, checksumAlgorithms(src.Checksums, r.Header.Get(headerChecksumAlg)))
+	o, err := s.store.Put(bucket, key, b, sealWith(b, a))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeXML(w, http.StatusOK, copyObjectResult{LastModified: o.LastModified.Format(timeFormat), ETag: quote(o.ETag)})
+}
+
+// checksumAlgorithms are the algorithms of the checksums and the one
+// asked for.
+func checksumAlgorithms(checksums map[string]string, algorithm string) []string {
+	var names []string
+	for name := range checksums {
+		if !strings.Contains(checksums[name], "-") {
+			names = append(names, name)
+		}
+	}
+	if algorithm = strings.ToLower(algorithm); algorithm != "" && checksums[algorithm] == "" {
+		names = append(names, algorithm)
+	}
+	return names
+}
+
+// copySource splits x-amz-copy-source, [/]bucket/key[?versionId=...].
+func copySource(source string) (string, string, error) {
+	source, _, _ = strings.Cut(strings.TrimPrefix(source, "/"), "?")
+	source, err := url.PathUnescape(source)
+	if err != nil {
+		return "", "", ErrInvalidArgument
+	}
+	bucket, key, ok := strings.Cut(source, "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", ErrInvalidArgument
+	}
+	return bucket, key, nil
+}
+
+func copyConditions(h http.Header, src Object) error {
+	if v := h.Get("X-Amz-Copy-Source-If-Match"); v != "" && !etagMatch(v, src.ETag) {
+		return ErrPreconditionFailed
+	}
+	if v := h.Get("X-Amz-Copy-Source-If-None-Match"); v != "" && etagMatch(v, src.ETag) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// getObject answers GET and HEAD, with the conditional headers and a byte
+// range.
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	q := r.URL.Query()
+	if q.Has("partNumber") {
+		writeError(w, r, ErrNotImplemented)
+		return
+	}
+	var o Object
+	var rc io.ReadSeekCloser
+	var err error
+	if r.Method == http.MethodHead {
+		o, err = s.store.Stat(bucket, key)
+	} else {
+		o, rc, err = s.store.Open(bucket, key)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if rc != nil {
+		defer func() { _ = rc.Close() }()
+	}
+	h := w.Header()
+	h.Set("ETag", quote(o.ETag))
+	h.Set("Last-Modified", httpTime(o.LastModified))
+	if notModified, err := conditions(r.Header, o); err != nil {
+		writeError(w, r, err)
+		return
+	} else if notModified {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("Content-Type", "binary/octet-stream")
+	if o.ContentType != "" {
+		h.Set("Content-Type", o.ContentType)
+	}
+	for name, value := range o.Headers {
+		h.Set(name, value)
+	}
+	for name, value := range o.Metadata {
+		h.Set(metaHeaderPrefix+name, value)
+	}
+	for param, name := range responseOverrides {
+		if q.Has(param) {
+			h.Set(name, q.Get(param))
+		}
+	}
+	start, length := int64(0), o.Size
+	status := http.StatusOK
+	// A list of ranges is served whole, as S3 does.
+	if spec := r.Header.Get("Range"); spec != "" && o.Size > 0 && !strings.Contains(spec, ",") {
+		var ok bool
+		if start, length, ok = parseRange(spec, o.Size); !ok {
+			h.Set("Content-Range", "bytes */"+strconv.FormatInt(o.Size, 10))
+			writeError(w, r, ErrInvalidRange)
+			return
+		}
+		status = http.StatusPartialContent
+		h.Set("Content-Range", "bytes "+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(start+length-1, 10)+"/"+strconv.FormatInt(o.Size, 10))
+	} else if strings.EqualFold(r.Header.Get("X-Amz-Checksum-Mode"), "ENABLED") {
+		setChecksumHeaders(h, o.Checksums)
+	}
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(status)
+	if rc == nil {
+		return
+	}
+	if _, err = rc.Seek(start, io.SeekStart); err == nil {
+		_, _ = io.CopyN(w, rc, length)
+	}
+}
+
+// conditions checks If-Match and If-Unmodified-Since, failing with
+// PreconditionFailed, and If-None-Match and If-Modified-Since, reporting
+// the object not modified.
+func conditions(h http.Header, o Object) (bool, error) {
+	modified := o.LastModified.Truncate(time.Second)
+	if v := h.Get("If-Match"); v != "" {
+		if !etagMatch(v, o.ETag) {
+			return false, ErrPreconditionFailed
+		}
+	} else if t, err := http.ParseTime(h.Get("If-Unmodified-Since")); err == nil && modified.After(t) {
+		return false, ErrPreconditionFailed
+	}
+	if v := h.Get("If-None-Match"); v != "" {
+		return etagMatch(v, o.ETag), nil
+	}
+	if t, err := http.ParseTime(h.Get("If-Modified-Since")); err == nil && !modified.After(t) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// etagMatch reports whether the ETag is in the list of an If-Match or
+// If-None-Match header.
+func etagMatch(list, etag string) bool {
+	for _, v := range strings.Split(list, ",") {
+		v = strings.Trim(strings.TrimPrefix(strings.TrimSpace(v), "W/"), `"`)
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange reads a single range, bytes=first-last, bytes=first- or
+// bytes=-suffix, returning the start and length within size.
+func parseRange(spec string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(spec, "bytes=")
+	if !ok {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false
+	}
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		n = min(n, size)
+		return size - n, n, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end - start + 1, true
+}
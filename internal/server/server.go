@@ -0,0 +1,220 @@
+// Package server is a minimal S3-compatible server over a directory or
+// memory, to exercise the commands and the CA and SNI handling without a
+// cluster: SigV4, buckets, objects, listings, multipart uploads and ranged
+// GETs, over HTTP or TLS with a generated CA.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+const (
+	headerRequestID = "X-Amz-Request-Id"
+	defaultRegion   = "us-east-1"
+	// minPartSize is the S3 minimum size of every part but the last.
+	minPartSize = 5 * 1024 * 1024
+	// shutdownTimeout is how long requests in flight get on shutdown.
+	shutdownTimeout = 10 * time.Second
+)
+
+// Options configure a Server.
+type Options struct {
+	// AccessKeyID and SecretAccessKey are the credentials the signatures
+	// are verified with; without an access key nothing is verified.
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+	// Domains take virtual-hosted style requests, <bucket>.<domain>.
+	Domains []string
+	// MinPartSize is the least size of every part but the last, 5 MiB
+	// when zero.
+	MinPartSize int64
+	Verbose     bool
+}
+
+// Server is the S3 API over a Store.
+type Server struct {
+	store   Store
+	opts    Options
+	mu      sync.Mutex
+	uploads map[string]*upload
+}
+
+func New(store Store, opts Options) *Server {
+	if opts.Region == "" {
+		opts.Region = defaultRegion
+	}
+	if opts.MinPartSize == 0 {
+		opts.MinPartSize = minPartSize
+	}
+	return &Server{store: store, opts: opts, uploads: make(map[string]*upload)}
+}
+
+// Serve runs the server on cfg.Listen over cfg.Root, or memory, until
+// interrupted.
+func Serve(cfg config.Config) error {
+	var store Store = NewMemoryStore()
+	where := "memory"
+	if cfg.Root != "" {
+		dir, err := NewDirStore(cfg.Root)
+		if err != nil {
+			return err
+		}
+		store, where = dir, cfg.Root
+	}
+	domains := []string{"localhost"}
+	if cfg.ServerName != "" {
+		domains = append(domains, cfg.ServerName)
+	}
+	srv := New(store, Options{
+		AccessKeyID:     cfg.AccessKeyID,
+		SecretAccessKey: cfg.SecretAccessKey,
+		Region:          cfg.Region,
+		Domains:         domains,
+		Verbose:         cfg.Verbose,
+	})
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if cfg.TLS {
+		caPath := cfg.CAOut
+		if caPath == "" {
+			caPath = filepath.Join(os.TempDir(), "awsfiles-ca.pem")
+			if cfg.Root != "" {
+				caPath = filepath.Join(cfg.Root, metaDir, "ca.pem")
+			}
+		}
+		tlsConfig, err := selfSignedTLS(append(domains, hostsOf(cfg.Listen)...), caPath, cfg.Verbose)
+		if err != nil {
+			_ = ln.Close()
+			return err
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+		scheme = "https"
+		slog.Info("Serve", "result", fmt.Sprintf("CA certificate: %s", caPath))
+	}
+	if cfg.AccessKeyID == "" {
+		slog.Info("Serve", "result", "no --access-key-id, signatures are not verified")
+	}
+	slog.Info("Serve", "result", fmt.Sprintf("%s://%s, store: %s", scheme, ln.Addr(), where))
+	httpServer := &http.Server{Handler: srv, ReadHeaderTimeout: time.Minute}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdown)
+	}()
+	if err = httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// hostsOf returns the host of the listen address for the certificate,
+// unless it listens on every address.
+func hostsOf(listen string) []string {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil || host == "" || net.ParseIP(host) != nil && net.ParseIP(host).IsUnspecified() {
+		return nil
+	}
+	return []string{host}
+}
+
+// statusWriter records the status of a response for the request log.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w}
+	sw.Header().Set(headerRequestID, newID(8))
+	sw.Header().Set("Server", "awsfiles")
+	s.serve(sw, r)
+	if sw.status == 0 {
+		// net/http answers 200 for a handler that wrote nothing.
+		sw.status = http.StatusOK
+	}
+	if s.opts.Verbose {
+		slog.Info("Serve", "request", fmt.Sprintf("%s %s %d %s", r.Method, r.URL.RequestURI(), sw.status, time.Since(start).Round(time.Microsecond)))
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	sig, err := s.authenticate(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	bucket, key := s.route(r)
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		s.listBuckets(w, r)
+	case bucket == "":
+		writeError(w, r, ErrMethodNotAllowed)
+	case key == "":
+		s.serveBucket(w, r, bucket)
+	default:
+		s.serveObject(w, r, sig, bucket, key)
+	}
+}
+
+// route returns the bucket and key of a virtual-hosted or path style
+// request.
+func (s *Server) route(r *http.Request) (string, string) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	for _, domain := range s.opts.Domains {
+		if bucket, ok := strings.CutSuffix(host, "."+domain); ok && bucket != "" {
+			return bucket, path
+		}
+	}
+	bucket, key, _ := strings.Cut(path, "/")
+	return bucket, key
+}
+
+// newID returns n random bytes in hex.
+func newID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return strings.ToUpper(hex.EncodeToString(b))
+}
@@ -0,0 +1,520 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/etag"
+	"github.com/vskurikhin/awsfiles/internal/object"
+	"github.com/vskurikhin/awsfiles/internal/server"
+	"github.com/vskurikhin/awsfiles/internal/upload"
+)
+
+const (
+	accessKeyID     = "AKIDSERVERTEST"
+	secretAccessKey = "server-test-secret"
+	region          = "us-east-1"
+	bucket          = "test-bucket"
+	mib             = 1024 * 1024
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(server.New(server.NewMemoryStore(), server.Options{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// newConfig builds the config of the settings the way the commands do,
+// through viper.
+func newConfig(t *testing.T, settings map[string]any) config.Config {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("region", region)
+	viper.Set("access_key_id", accessKeyID)
+	viper.Set("secret_access_key", secretAccessKey)
+	viper.Set("buffer_size", 32*1024)
+	for key, value := range settings {
+		viper.Set(key, value)
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("debug", false, "")
+	return config.MakeConfig(cmd)
+}
+
+// newBucket creates the test bucket through the client of cfg.
+func newBucket(t *testing.T, cfg config.Config) *s3.Client {
+	t.Helper()
+	s3Client := client.New(cfg)
+	if _, err := s3Client.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	return s3Client
+}
+
+func putObject(t *testing.T, s3Client *s3.Client, key string, data []byte) {
+	t.Helper()
+	_, err := s3Client.PutObject(context.Background(), &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: bytes.NewReader(data)})
+	if err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+}
+
+// testData is size bytes that differ from part to part.
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i*7 + i/mib)
+	}
+	return data
+}
+
+func responseStatus(err error) int {
+	var re *awshttp.ResponseError
+	if errors.As(err, &re) {
+		return re.HTTPStatusCode()
+	}
+	return 0
+}
+
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+func rawStatus(metadata middleware.Metadata) int {
+	if res, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+		return res.StatusCode
+	}
+	return 0
+}
+
+func TestSignatureMismatch(t *testing.T) {
+	ts := newServer(t)
+	tests := []struct {
+		name     string
+		settings map[string]any
+		code     string
+	}{
+		{"wrong secret", map[string]any{"secret_access_key": "not-the-secret"}, "SignatureDoesNotMatch"},
+		{"unknown access key", map[string]any{"access_key_id": "AKIDUNKNOWN"}, "InvalidAccessKeyId"},
+		{"anonymous", map[string]any{"anonymous": true}, "AccessDenied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := map[string]any{"s3_host": ts.URL}
+			for key, value := range tt.settings {
+				settings[key] = value
+			}
+			cfg := newConfig(t, settings)
+			_, err := client.New(cfg).CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+			if status := responseStatus(err); status != http.StatusForbidden {
+				t.Fatalf("CreateBucket: status %d, want %d: %v", status, http.StatusForbidden, err)
+			}
+			if code := errorCode(err); code != tt.code {
+				t.Errorf("CreateBucket: code %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+// chunkedRequest signs a PUT of the chunks as an aws-chunked body with a
+// CRC32C trailer, the way the SDKs stream uploads over TLS. Tamper changes
+// the body after it was signed.
+func chunkedRequest(t *testing.T, url string, chunks [][]byte, crc32c string, tamper func([]byte) []byte) *http.Request {
+	t.Helper()
+	const payload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	var decoded int
+	for _, chunk := range chunks {
+		decoded += len(chunk)
+	}
+	req, err := http.NewRequest(http.MethodPut, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Encoding", "aws-chunked")
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	req.Header.Set("X-Amz-Decoded-Content-Length", fmt.Sprint(decoded))
+	req.Header.Set("X-Amz-Trailer", "x-amz-checksum-crc32c")
+	now := time.Now().UTC()
+	creds := aws.Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey}
+	if err = v4.NewSigner().SignHTTP(context.Background(), creds, req, payload, "s3", region, now); err != nil {
+		t.Fatal(err)
+	}
+	_, seed, _ := strings.Cut(req.Header.Get("Authorization"), "Signature=")
+	date := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + region + "/s3/aws4_request"
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), now.Format("20060102"))
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	sign := func(algorithm, previous string, lines ...string) string {
+		toSign := strings.Join(append([]string{algorithm, date, scope, previous}, lines...), "\n")
+		return hex.EncodeToString(hmacSHA256(key, toSign))
+	}
+	emptyHash := sha256Hex(nil)
+	var body bytes.Buffer
+	previous := seed
+	for _, chunk := range append(chunks, nil) {
+		previous = sign("AWS4-HMAC-SHA256-PAYLOAD", previous, emptyHash, sha256Hex(chunk))
+		fmt.Fprintf(&body, "%x;chunk-signature=%s\r\n", len(chunk), previous)
+		if len(chunk) > 0 {
+			body.Write(chunk)
+			body.WriteString("\r\n")
+		}
+	}
+	trailer := "x-amz-checksum-crc32c:" + crc32c + "\n"
+	fmt.Fprintf(&body, "x-amz-checksum-crc32c:%s\r\n", crc32c)
+	fmt.Fprintf(&body, "x-amz-trailer-signature:%s\r\n\r\n", sign("AWS4-HMAC-SHA256-TRAILER", previous, sha256Hex([]byte(trailer))))
+	data := body.Bytes()
+	if tamper != nil {
+		data = tamper(data)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	return req
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestSignedChunkedTrailer(t *testing.T) {
+	ts := newServer(t)
+	cfg := newConfig(t, map[string]any{"s3_host": ts.URL})
+	s3Client := newBucket(t, cfg)
+	chunks := [][]byte{testData(64 * 1024), testData(1000)}
+	data := bytes.Join(chunks, nil)
+	sums := checksum.New(checksum.CRC32C)
+	_, _ = sums.Write(data)
+	crc32c := sums.Base64(checksum.CRC32C)
+	tests := []struct {
+		name   string
+		crc32c string
+		tamper func([]byte) []byte
+		status int
+	}{
+		{name: "signed", crc32c: crc32c, status: http.StatusOK},
+		{
+			name:   "chunk changed",
+			crc32c: crc32c,
+			tamper: func(b []byte) []byte {
+				i := bytes.Index(b, []byte("\r\n")) + 2
+				b[i+100] ^= 0xff
+				return b
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "chunk signature changed",
+			crc32c: crc32c,
+			tamper: func(b []byte) []byte {
+				return bytes.Replace(b, []byte("chunk-signature="), []byte("chunk-signature=0"), 1)
+			},
+			status: http.StatusForbidden,
+		},
+		{name: "trailer checksum wrong", crc32c: "AAAAAA==", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := strings.ReplaceAll(tt.name, " ", "-")
+			req := chunkedRequest(t, ts.URL+"/"+bucket+"/"+key, chunks, tt.crc32c, tt.tamper)
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+			if res.StatusCode != tt.status {
+				t.Fatalf("PUT: status %d, want %d: %s", res.StatusCode, tt.status, body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			out, err := s3Client.GetObject(context.Background(), &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), ChecksumMode: "ENABLED"})
+			if err != nil {
+				t.Fatalf("GetObject: %v", err)
+			}
+			got, err := io.ReadAll(out.Body)
+			_ = out.Body.Close()
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("GetObject: %d bytes, %v, want the %d bytes put", len(got), err, len(data))
+			}
+			if v := aws.ToString(out.ChecksumCRC32C); v != crc32c {
+				t.Errorf("GetObject: CRC32C %q, want %q", v, crc32c)
+			}
+			if sum := md5.Sum(data); etag.Trim(aws.ToString(out.ETag)) != hex.EncodeToString(sum[:]) {
+				t.Errorf("GetObject: ETag %s, want the MD5 %x", aws.ToString(out.ETag), sum)
+			}
+		})
+	}
+}
+
+func TestRange(t *testing.T) {
+	ts := newServer(t)
+	cfg := newConfig(t, map[string]any{"s3_host": ts.URL})
+	s3Client := newBucket(t, cfg)
+	data := testData(1000)
+	putObject(t, s3Client, "range", data)
+	tests := []struct {
+		spec         string
+		status       int
+		first, last  int
+		contentRange string
+	}{
+		{spec: "bytes=0-99", status: http.StatusPartialContent, first: 0, last: 99, contentRange: "bytes 0-99/1000"},
+		{spec: "bytes=900-", status: http.StatusPartialContent, first: 900, last: 999, contentRange: "bytes 900-999/1000"},
+		{spec: "bytes=-10", status: http.StatusPartialContent, first: 990, last: 999, contentRange: "bytes 990-999/1000"},
+		{spec: "bytes=-5000", status: http.StatusPartialContent, first: 0, last: 999, contentRange: "bytes 0-999/1000"},
+		{spec: "bytes=995-2000", status: http.StatusPartialContent, first: 995, last: 999, contentRange: "bytes 995-999/1000"},
+		{spec: "bytes=500-500", status: http.StatusPartialContent, first: 500, last: 500, contentRange: "bytes 500-500/1000"},
+		{spec: "bytes=1000-", status: http.StatusRequestedRangeNotSatisfiable},
+		{spec: "bytes=20-10", status: http.StatusRequestedRangeNotSatisfiable},
+		{spec: "bytes=-0", status: http.StatusRequestedRangeNotSatisfiable},
+		{spec: "bytes=x-", status: http.StatusRequestedRangeNotSatisfiable},
+		{spec: "items=0-10", status: http.StatusRequestedRangeNotSatisfiable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			out, err := s3Client.GetObject(context.Background(), &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String("range"), Range: aws.String(tt.spec)})
+			if tt.status == http.StatusRequestedRangeNotSatisfiable {
+				if status := responseStatus(err); status != tt.status {
+					t.Fatalf("GetObject: status %d, want %d: %v", status, tt.status, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetObject: %v", err)
+			}
+			got, err := io.ReadAll(out.Body)
+			_ = out.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status := rawStatus(out.ResultMetadata); status != tt.status {
+				t.Errorf("GetObject: status %d, want %d", status, tt.status)
+			}
+			if v := aws.ToString(out.ContentRange); v != tt.contentRange {
+				t.Errorf("GetObject: Content-Range %q, want %q", v, tt.contentRange)
+			}
+			if !bytes.Equal(got, data[tt.first:tt.last+1]) {
+				t.Errorf("GetObject: %d bytes, want bytes %d-%d", len(got), tt.first, tt.last)
+			}
+		})
+	}
+}
+
+func TestMultipartETag(t *testing.T) {
+	ts := newServer(t)
+	cfg := newConfig(t, map[string]any{"s3_host": ts.URL})
+	s3Client := newBucket(t, cfg)
+	ctx := context.Background()
+	data := testData(11*mib + 7)
+	partSize := 5 * mib
+	created, err := s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String(bucket), Key: aws.String("multipart")})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	var parts []s3types.CompletedPart
+	var sums []byte
+	for n, p := int32(1), data; len(p) > 0; n++ {
+		size := min(partSize, len(p))
+		out, err := s3Client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String("multipart"),
+			UploadId:   created.UploadId,
+			PartNumber: n,
+			Body:       bytes.NewReader(p[:size]),
+		})
+		if err != nil {
+			t.Fatalf("UploadPart %d: %v", n, err)
+		}
+		sum := md5.Sum(p[:size])
+		if etag.Trim(aws.ToString(out.ETag)) != hex.EncodeToString(sum[:]) {
+			t.Errorf("UploadPart %d: ETag %s, want the MD5 %x", n, aws.ToString(out.ETag), sum)
+		}
+		sums = append(sums, sum[:]...)
+		parts = append(parts, s3types.CompletedPart{ETag: out.ETag, PartNumber: n})
+		p = p[size:]
+	}
+	completed, err := s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String("multipart"),
+		UploadId:        created.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+	all := md5.Sum(sums)
+	want := hex.EncodeToString(all[:]) + "-3"
+	if got := etag.Trim(aws.ToString(completed.ETag)); got != want {
+		t.Errorf("CompleteMultipartUpload: ETag %s, want %s", got, want)
+	}
+	w := etag.NewWriter(int64(partSize))
+	_, _ = w.Write(data)
+	if !w.Matches(aws.ToString(completed.ETag)) {
+		t.Errorf("CompleteMultipartUpload: ETag %s, the etag.Writer computes %s", aws.ToString(completed.ETag), w.ETag())
+	}
+	head, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String("multipart")})
+	if err != nil {
+		t.Fatalf("HeadObject: %v", err)
+	}
+	if head.ContentLength != int64(len(data)) || etag.Trim(aws.ToString(head.ETag)) != want {
+		t.Errorf("HeadObject: %d bytes, ETag %s, want %d bytes, ETag %s", head.ContentLength, aws.ToString(head.ETag), len(data), want)
+	}
+}
+
+// roundTrip uploads size bytes through upload.PutObject and reads them
+// back through object.Fetch.
+func roundTrip(t *testing.T, cfg config.Config, key string, size int) {
+	t.Helper()
+	ctx := context.Background()
+	s3Client := client.New(cfg)
+	data := testData(size)
+	input := &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: bytes.NewReader(data)}
+	res, err := upload.PutObject(ctx, cfg, s3Client, input, int64(size))
+	if err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	sum := md5.Sum(data)
+	if res.Bytes != int64(size) || !bytes.Equal(res.MD5, sum[:]) {
+		t.Errorf("PutObject: %d bytes of MD5 %x, want %d bytes of MD5 %x", res.Bytes, res.MD5, size, sum)
+	}
+	if !res.ETag.Matches(res.ServerETag) {
+		t.Errorf("PutObject: server ETag %s, computed %s", res.ServerETag, res.ETag.ETag())
+	}
+	cfg.Bucket, cfg.Key = bucket, key
+	n, sums, header, err := object.Fetch(ctx, cfg, s3Client)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if n != int64(size) || !bytes.Equal(sums.Sum(checksum.MD5), sum[:]) {
+		t.Errorf("Fetch: %d bytes of MD5 %x, want %d bytes of MD5 %x", n, sums.Sum(checksum.MD5), size, sum)
+	}
+	if got := header.Get("ETag"); got != res.ServerETag {
+		t.Errorf("Fetch: ETag %s, want %s", got, res.ServerETag)
+	}
+	// A multipart upload, even of one part, has a checksum of the parts.
+	if strings.Contains(etag.Trim(res.ServerETag), "-") {
+		return
+	}
+	for _, name := range cfg.Checksum {
+		if got, want := header.Get("X-Amz-Checksum-"+name), sums.Base64(name); got != want {
+			t.Errorf("Fetch: %s %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ts := newServer(t)
+	cfg := newConfig(t, map[string]any{"s3_host": ts.URL, "checksum": []string{checksum.CRC32C}, "part_size": 5 * mib})
+	newBucket(t, cfg)
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"small", 1000},
+		{"one part", 5 * mib},
+		{"multipart", 11*mib + 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roundTrip(t, cfg, strings.ReplaceAll(tt.name, " ", "-"), tt.size)
+		})
+	}
+}
+
+func TestTLS(t *testing.T) {
+	ts := httptest.NewUnstartedServer(server.New(server.NewMemoryStore(), server.Options{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey}))
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The certificate of httptest is for example.com, which the client
+	// dials at the address of the listener.
+	endpoint := map[string]any{"s3_host": "https://example.com", "address": ts.Listener.Addr().String()}
+	tests := []struct {
+		name     string
+		settings map[string]any
+		trusted  bool
+	}{
+		{"ca file", map[string]any{"ca_file": caFile}, true},
+		{"ca file and server name", map[string]any{"ca_file": caFile, "server_name": "example.com"}, true},
+		{"no ca file", map[string]any{}, false},
+		{"other server name", map[string]any{"ca_file": caFile, "server_name": "other.test"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := map[string]any{}
+			for key, value := range endpoint {
+				settings[key] = value
+			}
+			for key, value := range tt.settings {
+				settings[key] = value
+			}
+			cfg := newConfig(t, settings)
+			if !cfg.Ssl() {
+				t.Fatalf("config of %s is not TLS", cfg.S3Host)
+			}
+			_, err := client.New(cfg).ListBuckets(context.Background(), &s3.ListBucketsInput{}, func(o *s3.Options) {
+				o.Retryer = aws.NopRetryer{}
+			})
+			if tt.trusted && err != nil {
+				t.Fatalf("ListBuckets: %v", err)
+			}
+			if !tt.trusted && err == nil {
+				t.Fatal("ListBuckets: the certificate was trusted")
+			}
+		})
+	}
+	cfg := newConfig(t, map[string]any{"s3_host": "https://example.com", "address": ts.Listener.Addr().String(), "ca_file": caFile, "server_name": "example.com"})
+	newBucket(t, cfg)
+	roundTrip(t, cfg, "over-tls", 1000)
+}
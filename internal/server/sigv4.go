@@ -0,0 +1,211 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat  = "20060102T150405Z"
+	// maxSkew is how far the time of a request may be off the server's.
+	maxSkew = 15 * time.Minute
+
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// streamingPrefix starts the payload hashes of aws-chunked bodies,
+	// which are verified chunk by chunk.
+	streamingPrefix       = "STREAMING-"
+	streamingSignedPrefix = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	emptySHA256           = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// signature is a verified SigV4 signature, with what the signatures of the
+// chunks of an aws-chunked body build on.
+type signature struct {
+	payload string // the signed x-amz-content-sha256
+	date    string
+	scope   string
+	key     []byte
+	value   string
+}
+
+// authenticate verifies the SigV4 signature of the request, from the
+// Authorization header or the query of a presigned URL. Without an access
+// key configured every request passes.
+func (s *Server) authenticate(r *http.Request) (*signature, error) {
+	if s.opts.AccessKeyID == "" {
+		return &signature{payload: r.Header.Get("X-Amz-Content-Sha256")}, nil
+	}
+	q := r.URL.Query()
+	var credential, signedHeaders, value, date string
+	sig := &signature{}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		algorithm, fields, _ := strings.Cut(auth, " ")
+		if algorithm != sigV4Algorithm {
+			return nil, ErrAccessDenied
+		}
+		for _, field := range strings.Split(fields, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch k {
+			case "Credential":
+				credential = v
+			case "SignedHeaders":
+				signedHeaders = v
+			case "Signature":
+				value = v
+			}
+		}
+		date = r.Header.Get("X-Amz-Date")
+		t, err := time.Parse(amzDateFormat, date)
+		if err != nil {
+			return nil, ErrAccessDenied
+		}
+		if d := time.Since(t); d > maxSkew || d < -maxSkew {
+			return nil, ErrRequestTimeTooSkewed
+		}
+		if sig.payload = r.Header.Get("X-Amz-Content-Sha256"); sig.payload == "" {
+			return nil, ErrMissingSecurityHeader
+		}
+	} else if q.Get("X-Amz-Algorithm") == sigV4Algorithm {
+		credential, signedHeaders, value = q.Get("X-Amz-Credential"), q.Get("X-Amz-SignedHeaders"), q.Get("X-Amz-Signature")
+		date = q.Get("X-Amz-Date")
+		t, err := time.Parse(amzDateFormat, date)
+		if err != nil {
+			return nil, ErrAccessDenied
+		}
+		expires, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+		if err != nil {
+			return nil, ErrAccessDenied
+		}
+		if time.Now().After(t.Add(time.Duration(expires) * time.Second)) {
+			return nil, ErrExpiredToken
+		}
+		if sig.payload = q.Get("X-Amz-Content-Sha256"); sig.payload == "" {
+			sig.payload = unsignedPayload
+		}
+	} else {
+		return nil, ErrAccessDenied
+	}
+	// Credential is <access key>/<date>/<region>/<service>/aws4_request.
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return nil, ErrAccessDenied
+	}
+	if parts[0] != s.opts.AccessKeyID {
+		return nil, ErrInvalidAccessKeyID
+	}
+	sig.date = date
+	sig.scope = strings.Join(parts[1:], "/")
+	sig.key = signingKey(s.opts.SecretAccessKey, parts[1], parts[2], parts[3])
+	canonical := strings.Join([]string{
+		r.Method,
+		awsEscape(r.URL.Path, false),
+		canonicalQuery(r.URL.RawQuery),
+		canonicalHeaders(r, signedHeaders),
+		signedHeaders,
+		sig.payload,
+	}, "\n")
+	sig.value = hex.EncodeToString(hmacSHA256(sig.key, sig.stringToSign(sigV4Algorithm, hashHex([]byte(canonical)))))
+	if !hmac.Equal([]byte(sig.value), []byte(value)) {
+		return nil, ErrSignatureDoesNotMatch
+	}
+	return sig, nil
+}
+
+func (sig *signature) stringToSign(algorithm string, lines ...string) string {
+	return strings.Join(append([]string{algorithm, sig.date, sig.scope}, lines...), "\n")
+}
+
+// chunkSignature is the signature of a chunk of an aws-chunked body,
+// following the previous one.
+func (sig *signature) chunkSignature(previous, chunkHash string) string {
+	toSign := sig.stringToSign(sigV4Algorithm+"-PAYLOAD", previous, emptySHA256, chunkHash)
+	return hex.EncodeToString(hmacSHA256(sig.key, toSign))
+}
+
+func signingKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalQuery sorts the query parameters but the signature, encoded
+// the SigV4 way.
+func canonicalQuery(rawQuery string) string {
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(param, "=")
+		k, _ = url.QueryUnescape(k)
+		v, _ = url.QueryUnescape(v)
+		if k == "X-Amz-Signature" {
+			continue
+		}
+		params = append(params, awsEscape(k, true)+"="+awsEscape(v, true))
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// canonicalHeaders lists the signed headers with their values trimmed.
+func canonicalHeaders(r *http.Request, signedHeaders string) string {
+	var b strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		var values []string
+		switch name {
+		case "host":
+			values = []string{r.Host}
+		case "content-length":
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		case "transfer-encoding":
+			values = append(values, r.TransferEncoding...)
+		default:
+			values = append(values, r.Header.Values(name)...)
+		}
+		for i, v := range values {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+		b.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	return b.String()
+}
+
+// awsEscape percent-encodes all but the unreserved characters and, unless
+// encoding a query, the slashes.
+func awsEscape(s string, query bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !query {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&15])
+	}
+	return b.String()
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Object is the metadata of a stored object or part.
+type Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+	ContentType  string    `json:"content_type,omitempty"`
+	// Headers are the other standard headers stored with the object,
+	// Cache-Control, Content-Encoding and the like.
+	Headers  map[string]string `json:"headers,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Checksums are the additional checksums by name, base64 encoded.
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// Bucket is a stored bucket.
+type Bucket struct {
+	Name    string
+	Created time.Time
+}
+
+// Store keeps the buckets, objects and the parts of multipart uploads.
+// Put and PutPart read the body and call seal with the object, filled in
+// but for the ETag and the metadata; an error of seal discards the body.
+type Store interface {
+	CreateBucket(name string) error
+	DeleteBucket(name string) error
+	Buckets() ([]Bucket, error)
+	StatBucket(name string) error
+	Put(bucket, key string, body io.Reader, seal func(*Object) error) (Object, error)
+	Open(bucket, key string) (Object, io.ReadSeekCloser, error)
+	Stat(bucket, key string) (Object, error)
+	// Delete removes the object, if there is one.
+	Delete(bucket, key string) error
+	// List returns the objects with the prefix in key order.
+	List(bucket, prefix string) ([]Object, error)
+	PutPart(upload string, part int32, body io.Reader, seal func(*Object) error) (Object, error)
+	OpenPart(upload string, part int32) (io.ReadCloser, error)
+	DeleteParts(upload string) error
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore keeps everything in memory, for tests.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	buckets map[string]*memoryBucket
+	parts   map[string]map[int32]memoryObject
+}
+
+type memoryBucket struct {
+	created time.Time
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	Object
+	data []byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*memoryBucket),
+		parts:   make(map[string]map[int32]memoryObject),
+	}
+}
+
+func (s *MemoryStore) CreateBucket(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[name]; ok {
+		return ErrBucketAlreadyExists
+	}
+	s.buckets[name] = &memoryBucket{created: time.Now().UTC(), objects: make(map[string]memoryObject)}
+	return nil
+}
+
+func (s *MemoryStore) DeleteBucket(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return ErrNoSuchBucket
+	}
+	if len(b.objects) > 0 {
+		return ErrBucketNotEmpty
+	}
+	delete(s.buckets, name)
+	return nil
+}
+
+func (s *MemoryStore) Buckets() ([]Bucket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	buckets := make([]Bucket, 0, len(s.buckets))
+	for name, b := range s.buckets {
+		buckets = append(buckets, Bucket{Name: name, Created: b.created})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+	return buckets, nil
+}
+
+func (s *MemoryStore) StatBucket(name string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.buckets[name]; !ok {
+		return ErrNoSuchBucket
+	}
+	return nil
+}
+
+func (s *MemoryStore) Put(bucket, key string, body io.Reader, seal func(*Object) error) (Object, error) {
+	if err := s.StatBucket(bucket); err != nil {
+		return Object{}, err
+	}
+	o, err := readMemoryObject(key, body, seal)
+	if err != nil {
+		return Object{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return Object{}, ErrNoSuchBucket
+	}
+	b.objects[key] = o
+	return o.Object, nil
+}
+
+func (s *MemoryStore) Open(bucket, key string) (Object, io.ReadSeekCloser, error) {
+	o, err := s.get(bucket, key)
+	if err != nil {
+		return Object{}, nil, err
+	}
+	return o.Object, nopCloser{bytes.NewReader(o.data)}, nil
+}
+
+func (s *MemoryStore) Stat(bucket, key string) (Object, error) {
+	o, err := s.get(bucket, key)
+	return o.Object, err
+}
+
+func (s *MemoryStore) get(bucket, key string) (memoryObject, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return memoryObject{}, ErrNoSuchBucket
+	}
+	o, ok := b.objects[key]
+	if !ok {
+		return memoryObject{}, ErrNoSuchKey
+	}
+	return o, nil
+}
+
+func (s *MemoryStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return ErrNoSuchBucket
+	}
+	delete(b.objects, key)
+	return nil
+}
+
+func (s *MemoryStore) List(bucket, prefix string) ([]Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil, ErrNoSuchBucket
+	}
+	var objects []Object
+	for key, o := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, o.Object)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *MemoryStore) PutPart(upload string, part int32, body io.Reader, seal func(*Object) error) (Object, error) {
+	o, err := readMemoryObject("", body, seal)
+	if err != nil {
+		return Object{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.parts[upload] == nil {
+		s.parts[upload] = make(map[int32]memoryObject)
+	}
+	s.parts[upload][part] = o
+	return o.Object, nil
+}
+
+func (s *MemoryStore) OpenPart(upload string, part int32) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.parts[upload][part]
+	if !ok {
+		return nil, ErrInvalidPart
+	}
+	return nopCloser{bytes.NewReader(o.data)}, nil
+}
+
+func (s *MemoryStore) DeleteParts(upload string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.parts, upload)
+	return nil
+}
+
+func readMemoryObject(key string, body io.Reader, seal func(*Object) error) (memoryObject, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return memoryObject{}, err
+	}
+	o := memoryObject{Object: Object{Key: key, Size: int64(len(data)), LastModified: time.Now().UTC()}, data: data}
+	if err = seal(&o.Object); err != nil {
+		return memoryObject{}, err
+	}
+	return o, nil
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
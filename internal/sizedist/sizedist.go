@@ -0,0 +1,181 @@
+// Package sizedist draws object sizes from a fixed size or a distribution,
+// to model the object-size mix of a real workload.
+package sizedist
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+// Distribution draws sizes in bytes.
+type Distribution interface {
+	Next(r *rand.Rand) int64
+	// Max is the largest size drawn, or -1 when unbounded.
+	Max() int64
+}
+
+// Parse reads a size spec:
+//
+//	65536, 512KiB, 10GB          a fixed size
+//	uniform:1KiB-10MiB          uniform between the bounds
+//	lognormal:1MiB,4MiB         log-normal with the given mean and stddev
+//	histogram:<file>            weighted lines "<size or min-max> <weight>"
+func Parse(spec string) (Distribution, error) {
+	kind, arg, ok := strings.Cut(spec, ":")
+	if !ok {
+		n, err := tool.ParseByteSize(spec)
+		if err != nil {
+			return nil, err
+		}
+		return fixed(n), nil
+	}
+	switch kind {
+	case "uniform":
+		lo, hi, err := parseRange(arg)
+		if err != nil {
+			return nil, fmt.Errorf("uniform: %w", err)
+		}
+		return uniform{lo, hi}, nil
+	case "lognormal":
+		return parseLognormal(arg)
+	case "histogram":
+		return parseHistogram(arg)
+	}
+	return nil, fmt.Errorf("unknown size distribution %q", kind)
+}
+
+type fixed int64
+
+func (f fixed) Next(*rand.Rand) int64 { return int64(f) }
+func (f fixed) Max() int64            { return int64(f) }
+
+type uniform struct{ lo, hi int64 }
+
+func (u uniform) Next(r *rand.Rand) int64 {
+	return u.lo + r.Int63n(u.hi-u.lo+1)
+}
+
+func (u uniform) Max() int64 { return u.hi }
+
+// lognormal holds the parameters of the underlying normal distribution.
+type lognormal struct{ mu, sigma float64 }
+
+func (l lognormal) Next(r *rand.Rand) int64 {
+	v := math.Exp(l.mu + l.sigma*r.NormFloat64())
+	if v >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(v)
+}
+
+func (l lognormal) Max() int64 { return -1 }
+
+// parseLognormal turns the mean and stddev of the sizes into mu and sigma.
+func parseLognormal(arg string) (Distribution, error) {
+	m, s, ok := strings.Cut(arg, ",")
+	if !ok {
+		return nil, fmt.Errorf("lognormal: expected mean,stddev, got %q", arg)
+	}
+	mean, err := tool.ParseByteSize(m)
+	if err != nil {
+		return nil, fmt.Errorf("lognormal: %w", err)
+	}
+	stddev, err := tool.ParseByteSize(s)
+	if err != nil {
+		return nil, fmt.Errorf("lognormal: %w", err)
+	}
+	if mean <= 0 {
+		return nil, fmt.Errorf("lognormal: mean must be positive, got %d", mean)
+	}
+	variance := math.Log(1 + math.Pow(float64(stddev)/float64(mean), 2))
+	return lognormal{mu: math.Log(float64(mean)) - variance/2, sigma: math.Sqrt(variance)}, nil
+}
+
+type bin struct {
+	lo, hi int64
+	weight float64 // cumulative
+}
+
+type histogram []bin
+
+func (h histogram) Next(r *rand.Rand) int64 {
+	x := r.Float64() * h[len(h)-1].weight
+	b := h[sort.Search(len(h), func(i int) bool { return h[i].weight > x })]
+	return uniform{b.lo, b.hi}.Next(r)
+}
+
+func (h histogram) Max() int64 {
+	var hi int64
+	for _, b := range h {
+		hi = max(hi, b.hi)
+	}
+	return hi
+}
+
+// parseHistogram reads the bins of the histogram file, skipping blank
+// lines and # comments.
+func parseHistogram(path string) (Distribution, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	var h histogram
+	var total float64
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected <size or min-max> <weight>", path, line)
+		}
+		lo, hi, err := parseRange(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		weight, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid weight %q", path, line, fields[1])
+		}
+		total += weight
+		h = append(h, bin{lo, hi, total})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("%s: no bins with weight", path)
+	}
+	return h, nil
+}
+
+// parseRange reads "min-max", or a single size as a range of one.
+func parseRange(s string) (int64, int64, error) {
+	a, b, ok := strings.Cut(s, "-")
+	if !ok {
+		b = a
+	}
+	lo, err := tool.ParseByteSize(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	hi, err := tool.ParseByteSize(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	if lo > hi {
+		return 0, 0, fmt.Errorf("range %q is empty", s)
+	}
+	return lo, hi, nil
+}
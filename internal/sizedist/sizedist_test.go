@@ -0,0 +1,89 @@
+package sizedist
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	dir := t.TempDir()
+	histogramFile := filepath.Join(dir, "sizes.txt")
+	if err := os.WriteFile(histogramFile, []byte("# small and large\n1KiB-4KiB 3\n\n1MiB 1 # fixed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(emptyFile, []byte("1KiB 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	badFile := filepath.Join(dir, "bad.txt")
+	if err := os.WriteFile(badFile, []byte("1KiB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		spec    string
+		lo, hi  int64 // bounds of the sizes drawn
+		max     int64
+		wantErr bool
+	}{
+		{spec: "65536", lo: 65536, hi: 65536, max: 65536},
+		{spec: "512KiB", lo: 512 << 10, hi: 512 << 10, max: 512 << 10},
+		{spec: "uniform:1KiB-10MiB", lo: 1 << 10, hi: 10 << 20, max: 10 << 20},
+		{spec: "uniform:5-5", lo: 5, hi: 5, max: 5},
+		{spec: "lognormal:1MiB,4MiB", lo: 0, hi: -1, max: -1},
+		{spec: "histogram:" + histogramFile, lo: 1 << 10, hi: 1 << 20, max: 1 << 20},
+		{spec: "ten", wantErr: true},
+		{spec: "uniform:10MiB-1KiB", wantErr: true},
+		{spec: "uniform:x-1KiB", wantErr: true},
+		{spec: "lognormal:1MiB", wantErr: true},
+		{spec: "lognormal:0,1MiB", wantErr: true},
+		{spec: "histogram:" + emptyFile, wantErr: true},
+		{spec: "histogram:" + badFile, wantErr: true},
+		{spec: "histogram:" + filepath.Join(dir, "missing.txt"), wantErr: true},
+		{spec: "pareto:1MiB", wantErr: true},
+	}
+	for _, tt := range tests {
+		d, err := Parse(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := d.Max(); got != tt.max {
+			t.Errorf("Parse(%q).Max() = %d, want %d", tt.spec, got, tt.max)
+		}
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 1000; i++ {
+			n := d.Next(r)
+			if n < tt.lo || tt.hi >= 0 && n > tt.hi {
+				t.Errorf("Parse(%q).Next() = %d, want within [%d, %d]", tt.spec, n, tt.lo, tt.hi)
+				break
+			}
+		}
+	}
+}
+
+func TestHistogramWeights(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sizes.txt")
+	if err := os.WriteFile(path, []byte("1 3\n2 0\n3 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Parse("histogram:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[int64]int)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 4000; i++ {
+		counts[d.Next(r)]++
+	}
+	if counts[2] != 0 {
+		t.Errorf("the bin of weight 0 was drawn %d times", counts[2])
+	}
+	if counts[1] < 2*counts[3] {
+		t.Errorf("sizes drawn %v, want about three times as many 1 as 3", counts)
+	}
+}
@@ -0,0 +1,312 @@
+package syncdir
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/etag"
+	"github.com/vskurikhin/awsfiles/internal/listing"
+	"github.com/vskurikhin/awsfiles/internal/object"
+	"github.com/vskurikhin/awsfiles/internal/remove"
+	"github.com/vskurikhin/awsfiles/internal/upload"
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+const (
+	CompareChecksum = "checksum"
+	CompareMtime    = "mtime"
+)
+
+// file is a local file or an object, keyed by its path relative to the
+// synchronized directory or prefix.
+type file struct {
+	rel   string
+	path  string // local files only
+	key   string // objects only, as listed
+	size  int64
+	mtime time.Time
+	etag  string // objects only
+}
+
+type summary struct {
+	transferred atomic.Int64
+	skipped     atomic.Int64
+	failed      atomic.Int64
+	bytes       atomic.Int64
+	deleted     atomic.Int64
+}
+
+// Sync makes dst match src, where one of them is a local directory and the
+// other s3://bucket/prefix.
+func Sync(cfg config.Config, src, dst string) {
+	ctx := context.Background()
+	s3Client := client.New(cfg)
+	filter, err := listing.MakeFilter(cfg)
+	if err != nil {
+		slog.Error("Sync failed", "err", err)
+		return
+	}
+	bucket, prefix, upward := tool.ParseS3URI(dst)
+	dir := src
+	if !upward {
+		var ok bool
+		if bucket, prefix, ok = tool.ParseS3URI(src); !ok {
+			slog.Error("Sync failed", "err", "one of source and destination must be s3://bucket/prefix")
+			return
+		}
+		dir = dst
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			slog.Error("Sync failed", "err", err)
+			return
+		}
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	local, err := localFiles(dir, filter)
+	if err != nil {
+		slog.Error("Sync failed", "err", err)
+		return
+	}
+	remote, err := remoteFiles(ctx, s3Client, bucket, prefix, filter)
+	if err != nil {
+		slog.Error("Sync failed", "err", err)
+		return
+	}
+	s := &summary{}
+	if upward {
+		transfer(cfg, local, remote, s, func(f file) error {
+			return put(ctx, cfg, s3Client, s, filepath.Join(dir, f.rel), bucket, prefix+f.rel)
+		})
+		if cfg.Delete {
+			deleteRemote(ctx, cfg, s3Client, s, bucket, remote, extraneous(local, remote))
+		}
+	} else {
+		transfer(cfg, remote, local, s, func(f file) error {
+			return get(ctx, cfg, s3Client, s, bucket, f.key, filepath.Join(dir, f.rel))
+		})
+		if cfg.Delete {
+			deleteLocal(cfg, s, dir, extraneous(remote, local))
+		}
+	}
+	dryRun := ""
+	if cfg.DryRun {
+		dryRun = "(dry run) "
+	}
+	slog.Info("Sync", "result", fmt.Sprintf("%stransferred: %d, skipped: %d, deleted: %d, failed: %d, bytes: %d",
+		dryRun, s.transferred.Load(), s.skipped.Load(), s.deleted.Load(), s.failed.Load(), s.bytes.Load()))
+}
+
+// transfer runs fn for the changed files of from with cfg.Concurrency
+// workers.
+func transfer(cfg config.Config, from, to map[string]file, s *summary, fn func(f file) error) {
+	jobs := make(chan file)
+	var wg sync.WaitGroup
+	for i := 0; i < max(cfg.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				if err := fn(f); err != nil {
+					slog.Error("Sync failed", "path", f.rel, "err", err)
+					s.failed.Add(1)
+				}
+			}
+		}()
+	}
+	for _, rel := range sortedKeys(from) {
+		f := from[rel]
+		if other, ok := to[rel]; !ok || changed(cfg, f, other) {
+			jobs <- f
+		} else {
+			s.skipped.Add(1)
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// changed compares size and mtime, or with --compare checksum the local
+// MD5 or multipart ETag with the ETag of the object.
+func changed(cfg config.Config, f, other file) bool {
+	if f.size != other.size {
+		return true
+	}
+	if cfg.Compare == CompareChecksum {
+		local, remote := f, other
+		if f.path == "" {
+			local, remote = other, f
+		}
+		ok, err := etag.MatchesFile(local.path, remote.etag, local.size, int64(cfg.PartSize))
+		if err != nil {
+			slog.Error("Checksum failed", "path", local.path, "err", err)
+		}
+		return err != nil || !ok
+	}
+	return f.mtime.After(other.mtime)
+}
+
+func put(ctx context.Context, cfg config.Config, s3Client *s3.Client, s *summary, path, bucket, key string) error {
+	if cfg.DryRun {
+		fmt.Printf("(dry run) upload: %s to s3://%s/%s\n", path, bucket, key)
+		s.transferred.Add(1)
+		return nil
+	}
+	input, err := upload.MakePutObjectInput(cfg, bucket, key)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	input.Body = f
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	res, err := upload.PutObject(ctx, cfg, s3Client, input, fi.Size())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("upload: %s to s3://%s/%s\n", path, bucket, key)
+	s.transferred.Add(1)
+	s.bytes.Add(res.Bytes)
+	return nil
+}
+
+func get(ctx context.Context, cfg config.Config, s3Client *s3.Client, s *summary, bucket, key, path string) error {
+	if cfg.DryRun {
+		fmt.Printf("(dry run) download: s3://%s/%s to %s\n", bucket, key, path)
+		s.transferred.Add(1)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	n, _, err := object.DownloadFile(ctx, cfg, s3Client, bucket, key, path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("download: s3://%s/%s to %s\n", bucket, key, path)
+	s.transferred.Add(1)
+	s.bytes.Add(n)
+	return nil
+}
+
+func deleteRemote(ctx context.Context, cfg config.Config, s3Client *s3.Client, s *summary, bucket string, remote map[string]file, rels []string) {
+	keys := make([]string, 0, len(rels))
+	for _, rel := range rels {
+		keys = append(keys, remote[rel].key)
+	}
+	var rs remove.Summary
+	remove.DeleteKeys(ctx, cfg, s3Client, bucket, keys, &rs)
+	s.deleted.Add(rs.Deleted.Load())
+	s.failed.Add(rs.Failed.Load())
+}
+
+func deleteLocal(cfg config.Config, s *summary, dir string, rels []string) {
+	for _, rel := range rels {
+		path := filepath.Join(dir, rel)
+		if cfg.DryRun {
+			fmt.Printf("(dry run) delete: %s\n", path)
+		} else if err := os.Remove(path); err != nil {
+			slog.Error("Delete failed", "path", path, "err", err)
+			s.failed.Add(1)
+			continue
+		} else {
+			fmt.Printf("delete: %s\n", path)
+		}
+		s.deleted.Add(1)
+	}
+}
+
+// extraneous returns what only exists on the destination side.
+func extraneous(from, to map[string]file) []string {
+	var result []string
+	for _, rel := range sortedKeys(to) {
+		if _, ok := from[rel]; !ok {
+			result = append(result, rel)
+		}
+	}
+	return result
+}
+
+// localFiles walks dir for the files passing the filter.
+func localFiles(dir string, filter listing.Filter) (map[string]file, error) {
+	result := make(map[string]file)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return result, nil
+	}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		mtime := info.ModTime()
+		if filter.Match(listing.Entry{Key: rel, Size: info.Size(), LastModified: &mtime}) {
+			result[rel] = file{rel: rel, path: p, size: info.Size(), mtime: mtime}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// remoteFiles lists the objects under prefix by their cleaned relative
+// path, skipping the keys whose path leads out of the directory.
+func remoteFiles(ctx context.Context, s3Client *s3.Client, bucket, prefix string, filter listing.Filter) (map[string]file, error) {
+	result := make(map[string]file)
+	err := listing.Walk(ctx, s3Client, bucket, prefix, true, func(e listing.Entry) bool {
+		rel := strings.TrimPrefix(e.Key, prefix)
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			return true
+		}
+		if rel = path.Clean(rel); path.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			slog.Warn("Sync skipped a key outside the prefix", "key", e.Key)
+			return true
+		}
+		entry := e
+		entry.Key = rel
+		if filter.Match(entry) {
+			f := file{rel: rel, key: e.Key, size: e.Size, etag: e.ETag}
+			if e.LastModified != nil {
+				f.mtime = *e.LastModified
+			}
+			result[f.rel] = f
+		}
+		return true
+	})
+	return result, err
+}
+
+func sortedKeys(files map[string]file) []string {
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
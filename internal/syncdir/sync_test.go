@@ -0,0 +1,103 @@
+package syncdir_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/server"
+	"github.com/vskurikhin/awsfiles/internal/syncdir"
+)
+
+const bucket = "sync-bucket"
+
+// newConfig builds the config of the settings the way the commands do,
+// through viper.
+func newConfig(t *testing.T, settings map[string]any) config.Config {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("region", "us-east-1")
+	viper.Set("buffer_size", 32*1024)
+	viper.Set("concurrency", 2)
+	for key, value := range settings {
+		viper.Set(key, value)
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("debug", false, "")
+	return config.MakeConfig(cmd)
+}
+
+func TestSyncDownKeysOutsidePrefix(t *testing.T) {
+	store := server.NewMemoryStore()
+	if err := store.CreateBucket(bucket); err != nil {
+		t.Fatal(err)
+	}
+	// Every object has its key as data, to tell which key was fetched.
+	keys := []string{
+		"p/ok.txt",
+		"p/a//b.txt",
+		"p/./c.txt",
+		"p/../../escape.txt",
+		"p/../sibling.txt",
+		"p/sub/../../up.txt",
+		"p/..",
+	}
+	for _, key := range keys {
+		_, err := store.Put(bucket, key, bytes.NewReader([]byte(key)), func(o *server.Object) error {
+			o.ETag = "0123456789abcdef0123456789abcdef"
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := httptest.NewServer(server.New(store, server.Options{}))
+	t.Cleanup(ts.Close)
+	root := t.TempDir()
+	dir := filepath.Join(root, "one", "two", "sync")
+	cfg := newConfig(t, map[string]any{"s3_host": ts.URL, "anonymous": true})
+
+	syncdir.Sync(cfg, "s3://"+bucket+"/p", dir)
+
+	want := map[string]string{
+		"ok.txt":  "p/ok.txt",
+		"a/b.txt": "p/a//b.txt",
+		"c.txt":   "p/./c.txt",
+	}
+	got := make(map[string]string)
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		got[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rel, key := range want {
+		if got[rel] != key {
+			t.Errorf("%s has %q, want the object %q", rel, got[rel], key)
+		}
+	}
+	for rel := range got {
+		if _, ok := want[rel]; !ok {
+			t.Errorf("sync wrote %s", rel)
+		}
+	}
+}
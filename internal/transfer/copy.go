@@ -0,0 +1,252 @@
+package transfer
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/object"
+	"github.com/vskurikhin/awsfiles/internal/upload"
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+const (
+	// maxCopyObjectSize is the largest object CopyObject accepts.
+	maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// copyPartSize is the part size of multipart copies without
+	// --part-size, minCopyPartSize the S3 minimum of every part but the
+	// last.
+	copyPartSize    = 512 * 1024 * 1024
+	minCopyPartSize = 5 * 1024 * 1024
+	maxParts        = 10000
+
+	MetadataDirectiveCopy    = "COPY"
+	MetadataDirectiveReplace = "REPLACE"
+)
+
+// Copy copies src to dst, each either s3://bucket/key or a local path.
+// Objects on the same endpoint are copied server side, objects between
+// differently configured endpoints are streamed through the client.
+func Copy(srcCfg, dstCfg config.Config, src, dst string) {
+	srcBucket, srcKey, srcS3 := tool.ParseS3URI(src)
+	dstBucket, dstKey, dstS3 := tool.ParseS3URI(dst)
+	if dstKey == "" || strings.HasSuffix(dstKey, "/") {
+		dstKey += path.Base(filepath.ToSlash(strings.TrimPrefix(src, "s3://")))
+	}
+	ctx := context.Background()
+	switch {
+	case srcS3 && dstS3 && srcCfg.Profile == dstCfg.Profile:
+		err := serverSideCopy(ctx, dstCfg, client.New(dstCfg), srcBucket, srcKey, dstBucket, dstKey)
+		if err != nil {
+			slog.Error("Copy failed", "err", err)
+			return
+		}
+		slog.Info("Copy", "result", fmt.Sprintf("s3://%s/%s -> s3://%s/%s", srcBucket, srcKey, dstBucket, dstKey))
+	case srcS3 && dstS3:
+		streamCopy(ctx, srcCfg, dstCfg, srcBucket, srcKey, dstBucket, dstKey)
+	case dstS3:
+		upload.PutFile(dstCfg, src, dstBucket, dstKey)
+	case srcS3:
+		if info, err := os.Stat(dst); err == nil && info.IsDir() {
+			dst = filepath.Join(dst, path.Base(srcKey))
+		}
+		object.Download(srcCfg, srcBucket, srcKey, dst)
+	default:
+		slog.Error("Copy failed", "err", "one of source and destination must be s3://bucket/key")
+	}
+}
+
+// serverSideCopy uses CopyObject, or UploadPartCopy for objects CopyObject
+// can not handle.
+func serverSideCopy(ctx context.Context, cfg config.Config, s3Client *s3.Client, srcBucket, srcKey, dstBucket, dstKey string) error {
+	head, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return err
+	}
+	metadata, err := tool.ParseKeyValues(cfg.Metadata)
+	if err != nil {
+		return err
+	}
+	directive := types.MetadataDirective(strings.ToUpper(cfg.MetadataDirective))
+	if directive == "" && (len(metadata) > 0 || cfg.ContentType != "") {
+		directive = types.MetadataDirectiveReplace
+	}
+	source := copySource(srcBucket, srcKey)
+	if head.ContentLength <= maxCopyObjectSize {
+		input := &s3.CopyObjectInput{
+			Bucket:            aws.String(dstBucket),
+			Key:               aws.String(dstKey),
+			CopySource:        aws.String(source),
+			MetadataDirective: directive,
+			StorageClass:      types.StorageClass(cfg.StorageClass),
+		}
+		if directive == types.MetadataDirectiveReplace {
+			input.Metadata = metadata
+			input.ContentType = optional(cfg.ContentType)
+		}
+		_, err = s3Client.CopyObject(ctx, input)
+		return err
+	}
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:       aws.String(dstBucket),
+		Key:          aws.String(dstKey),
+		StorageClass: types.StorageClass(cfg.StorageClass),
+		Metadata:     head.Metadata,
+		ContentType:  head.ContentType,
+	}
+	if directive == types.MetadataDirectiveReplace {
+		create.Metadata = metadata
+		create.ContentType = optional(cfg.ContentType)
+	}
+	return multipartCopy(ctx, cfg, s3Client, create, source, head.ContentLength)
+}
+
+// copyPartSizeOf returns cfg.PartSize, or copyPartSize when it is zero,
+// raised so that size bytes fit in maxParts.
+func copyPartSizeOf(cfg config.Config, size int64) (int64, error) {
+	partSize := int64(copyPartSize)
+	if ps := int64(cfg.PartSize); ps != 0 {
+		if ps < minCopyPartSize || ps > maxCopyObjectSize {
+			return 0, fmt.Errorf("part size %d is out of range [%d, %d]", ps, minCopyPartSize, maxCopyObjectSize)
+		}
+		partSize = ps
+	}
+	return max(partSize, (size+maxParts-1)/maxParts), nil
+}
+
+// multipartCopy copies the source in ranges with cfg.Concurrency workers
+// and aborts the upload on the first failure.
+func multipartCopy(ctx context.Context, cfg config.Config, s3Client *s3.Client, create *s3.CreateMultipartUploadInput, source string, size int64) error {
+	partSize, err := copyPartSizeOf(cfg, size)
+	if err != nil {
+		return err
+	}
+	mpu, err := s3Client.CreateMultipartUpload(ctx, create)
+	if err != nil {
+		return err
+	}
+	count := int32((size + partSize - 1) / partSize)
+	parts := make([]types.CompletedPart, 0, count)
+	numbers := make(chan int32)
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for i := 0; i < max(cfg.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range numbers {
+				first := int64(n-1) * partSize
+				last := min(first+partSize, size) - 1
+				out, err := s3Client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+					Bucket:          create.Bucket,
+					Key:             create.Key,
+					UploadId:        mpu.UploadId,
+					PartNumber:      n,
+					CopySource:      aws.String(source),
+					CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", first, last)),
+				})
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				} else if err == nil {
+					parts = append(parts, types.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: n})
+					if cfg.Verbose {
+						fmt.Printf("copied part %d/%d\r", len(parts), count)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for n := int32(1); n <= count && ctx.Err() == nil; n++ {
+		numbers <- n
+	}
+	close(numbers)
+	wg.Wait()
+	if firstErr == nil {
+		sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+		_, firstErr = s3Client.CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
+			Bucket:          create.Bucket,
+			Key:             create.Key,
+			UploadId:        mpu.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+	if firstErr != nil {
+		_, _ = s3Client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   create.Bucket,
+			Key:      create.Key,
+			UploadId: mpu.UploadId,
+		})
+	}
+	return firstErr
+}
+
+// streamCopy reads the object from one endpoint and uploads it to another.
+func streamCopy(ctx context.Context, srcCfg, dstCfg config.Config, srcBucket, srcKey, dstBucket, dstKey string) {
+	res, err := client.New(srcCfg).GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		slog.Error("Copy failed", "err", err)
+		return
+	}
+	defer func() { _ = res.Body.Close() }()
+	input, err := upload.MakePutObjectInput(dstCfg, dstBucket, dstKey)
+	if err != nil {
+		slog.Error("Copy failed", "err", err)
+		return
+	}
+	if !strings.EqualFold(dstCfg.MetadataDirective, MetadataDirectiveReplace) && len(input.Metadata) == 0 {
+		input.Metadata = res.Metadata
+		if input.ContentType == nil {
+			input.ContentType = res.ContentType
+		}
+	}
+	input.Body = res.Body
+	result, err := upload.PutObject(ctx, dstCfg, client.New(dstCfg), input, res.ContentLength)
+	if err != nil {
+		slog.Error("Copy failed", "err", err)
+		return
+	}
+	slog.Info("Copy", "result", fmt.Sprintf("s3://%s/%s -> s3://%s/%s", srcBucket, srcKey, dstBucket, dstKey))
+	slog.Info("Copy", "result", fmt.Sprintf("total copied bytes: %d", result.Bytes))
+	slog.Info("Copy", "result", fmt.Sprintf("md5sum: %s", hex.EncodeToString(result.MD5)))
+	upload.LogChecksums(result)
+	upload.LogParts(dstCfg, result)
+}
+
+func copySource(bucket, key string) string {
+	return url.PathEscape(bucket) + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
@@ -0,0 +1,152 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+
+	"github.com/vskurikhin/awsfiles/internal/config"
+)
+
+const (
+	mib = 1024 * 1024
+	// maxParts is the S3 limit of parts of a multipart upload.
+	maxParts = 10000
+	// minPartSize is the S3 minimum size of every part but the last.
+	minPartSize = 5 * mib
+	// maxPartSize is the S3 maximum size of a part.
+	maxPartSize = 5 * 1024 * mib
+)
+
+// PartTiming is how long the upload of a part took.
+type PartTiming struct {
+	PartNumber int32
+	Size       int64 // -1 when the body does not tell
+	Elapsed    time.Duration
+}
+
+// PartSize returns cfg.PartSize, or when it is zero the smallest whole
+// number of MiB from 5 MiB up that keeps size bytes within maxParts. A
+// negative size is unknown.
+func PartSize(cfg config.Config, size int64) (int64, error) {
+	if ps := int64(cfg.PartSize); ps != 0 {
+		if ps < minPartSize || ps > maxPartSize {
+			return 0, fmt.Errorf("part size %d is out of range [%d, %d]", ps, minPartSize, maxPartSize)
+		}
+		if parts := (size + ps - 1) / ps; parts > maxParts {
+			return 0, fmt.Errorf("part size %d makes %d parts of %d bytes, the limit is %d", ps, parts, size, maxParts)
+		}
+		return ps, nil
+	}
+	ps := int64(partMiBs * mib)
+	if size > ps*maxParts {
+		ps = ((size+maxParts-1)/maxParts + mib - 1) / mib * mib
+	}
+	if ps > maxPartSize {
+		return 0, fmt.Errorf("%d bytes do not fit in %d parts", size, maxParts)
+	}
+	return ps, nil
+}
+
+// LogParts reports the parts of the upload and their throughput, each
+// part when verbose.
+func LogParts(cfg config.Config, res Result) {
+	if len(res.Parts) == 0 {
+		return
+	}
+	slog.Info("Upload", "result", fmt.Sprintf("parts: %d, part size: %d", len(res.Parts), res.PartSize))
+	var lo, hi, sum float64
+	var timed int
+	for _, p := range res.Parts {
+		if p.Size < 0 || p.Elapsed <= 0 {
+			continue
+		}
+		rate := float64(p.Size) / mib / p.Elapsed.Seconds()
+		if cfg.Verbose {
+			slog.Info("Upload", "part", fmt.Sprintf("%d: %d bytes in %s, %.2f MiB/s", p.PartNumber, p.Size, p.Elapsed.Round(time.Millisecond), rate))
+		}
+		if timed == 0 || rate < lo {
+			lo = rate
+		}
+		hi = max(hi, rate)
+		sum += rate
+		timed++
+	}
+	if timed > 0 {
+		slog.Info("Upload", "result", fmt.Sprintf("part throughput MiB/s min: %.2f, avg: %.2f, max: %.2f", lo, sum/float64(timed), hi))
+	}
+}
+
+// partTimer records the duration of the UploadPart calls, or the PutObject
+// call of an upload too small to be split.
+type partTimer struct {
+	mu    sync.Mutex
+	parts []PartTiming
+}
+
+func (t *partTimer) add(p PartTiming) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.parts = append(t.parts, p)
+}
+
+// sorted returns the timings in part order.
+func (t *partTimer) sorted() []PartTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := append([]PartTiming(nil), t.parts...)
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+	return parts
+}
+
+func (t *partTimer) addMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("PartTimer", func(
+		ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+	) (middleware.InitializeOutput, middleware.Metadata, error) {
+		var p PartTiming
+		switch input := in.Parameters.(type) {
+		case *s3.UploadPartInput:
+			p = PartTiming{PartNumber: input.PartNumber, Size: bodySize(input.Body)}
+		case *s3.PutObjectInput:
+			p = PartTiming{PartNumber: 1, Size: bodySize(input.Body)}
+		default:
+			return next.HandleInitialize(ctx, in)
+		}
+		start := time.Now()
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		if err == nil {
+			p.Elapsed = time.Since(start)
+			t.add(p)
+		}
+		return out, metadata, err
+	}), middleware.After)
+}
+
+// bodySize returns the remaining length of a seekable body, or -1.
+func bodySize(body io.Reader) int64 {
+	s, ok := body.(io.Seeker)
+	if !ok {
+		return -1
+	}
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	if _, err = s.Seek(cur, io.SeekStart); err != nil {
+		return -1
+	}
+	return end - cur
+}
@@ -0,0 +1,94 @@
+package upload
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/vskurikhin/awsfiles/internal/client"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/pkg/tool"
+)
+
+// PutFile uploads the local file to s3://bucket/key.
+func PutFile(cfg config.Config, path, bucket, key string) {
+	input, err := MakePutObjectInput(cfg, bucket, key)
+	if err != nil {
+		slog.Error("Upload failed", "err", err)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		slog.Error("Upload failed", "err", err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	var res Result
+	if cfg.Resume {
+		res, err = resumeFile(context.Background(), cfg, client.New(cfg), input, f)
+	} else {
+		input.Body = f
+		res, err = PutObject(context.Background(), cfg, client.New(cfg), input, fileSize(f))
+	}
+	if err != nil {
+		slog.Error("Upload failed", "err", err)
+		return
+	}
+	slog.Info("Upload", "result", fmt.Sprintf("s3://%s/%s", bucket, key))
+	slog.Info("Upload", "result", fmt.Sprintf("total write bytes: %d", res.Bytes))
+	slog.Info("Upload", "result", fmt.Sprintf("md5sum: %s", hex.EncodeToString(res.MD5)))
+	LogChecksums(res)
+	LogParts(cfg, res)
+}
+
+// fileSize returns the size of f, or -1 when it cannot be told.
+func fileSize(f *os.File) int64 {
+	fi, err := f.Stat()
+	if err != nil {
+		return -1
+	}
+	return fi.Size()
+}
+
+// MakePutObjectInput applies the content type, storage class and
+// metadata settings.
+func MakePutObjectInput(cfg config.Config, bucket, key string) (*s3.PutObjectInput, error) {
+	metadata, err := tool.ParseKeyValues(cfg.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.PutObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		Metadata:     metadata,
+		StorageClass: types.StorageClass(cfg.StorageClass),
+	}
+	if cfg.ContentType != "" {
+		input.ContentType = aws.String(cfg.ContentType)
+	}
+	return input, nil
+}
+
+// resumeFile is PutFile with a checkpoint.
+func resumeFile(ctx context.Context, cfg config.Config, s3Client *s3.Client, input *s3.PutObjectInput, f *os.File) (Result, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return Result{}, err
+	}
+	source, err := filepath.Abs(f.Name())
+	if err != nil {
+		return Result{}, err
+	}
+	cp, path, err := openCheckpoint(cfg, aws.ToString(input.Bucket), aws.ToString(input.Key), source, fi.Size())
+	if err != nil {
+		return Result{}, err
+	}
+	return resumeUpload(ctx, cfg, s3Client, input, f, cp, path)
+}
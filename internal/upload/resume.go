@@ -0,0 +1,352 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/etag"
+	"github.com/vskurikhin/awsfiles/internal/multipart"
+)
+
+// Checkpoint is the state of a resumable multipart upload, rewritten after
+// every part.
+type Checkpoint struct {
+	Bucket   string           `json:"bucket"`
+	Key      string           `json:"key"`
+	UploadID string           `json:"upload_id"`
+	Size     int64            `json:"size"`
+	PartSize int64            `json:"part_size"`
+	Seed     int64            `json:"seed,omitempty"`
+	Source   string           `json:"source,omitempty"`
+	Parts    []CheckpointPart `json:"parts"`
+}
+
+// CheckpointPart is a part the upload completed.
+type CheckpointPart struct {
+	PartNumber int32  `json:"part_number"`
+	Size       int64  `json:"size"`
+	ETag       string `json:"etag"`
+	MD5        string `json:"md5"`
+	Checksum   string `json:"checksum,omitempty"`
+}
+
+// CheckpointPath returns the checkpoint file of s3://bucket/key unless
+// checkpoint is given.
+func CheckpointPath(checkpoint, bucket, key string) string {
+	if checkpoint != "" {
+		return checkpoint
+	}
+	sum := sha1.Sum([]byte(bucket + "/" + key))
+	return filepath.Join(os.TempDir(), "awsfiles-"+hex.EncodeToString(sum[:8])+".checkpoint.json")
+}
+
+// LoadCheckpoint reads the checkpoint at path, returning nil when there is
+// none.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err = json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// save writes the checkpoint through a temporary file, so that a crash never
+// leaves it truncated.
+func (c *Checkpoint) save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (c *Checkpoint) part(n int32) *CheckpointPart {
+	for i := range c.Parts {
+		if c.Parts[i].PartNumber == n {
+			return &c.Parts[i]
+		}
+	}
+	return nil
+}
+
+func (c *Checkpoint) setPart(p CheckpointPart) {
+	if old := c.part(p.PartNumber); old != nil {
+		*old = p
+		return
+	}
+	c.Parts = append(c.Parts, p)
+	sort.Slice(c.Parts, func(i, j int) bool {
+		return c.Parts[i].PartNumber < c.Parts[j].PartNumber
+	})
+}
+
+// check reports whether the checkpoint belongs to this upload.
+func (c *Checkpoint) check(bucket, key, source string, size int64) error {
+	if c.Bucket != bucket || c.Key != key || c.Source != source || c.Size != size {
+		return fmt.Errorf("checkpoint of s3://%s/%s (%s, %d bytes) does not match this upload, remove it to start over",
+			c.Bucket, c.Key, c.Source, c.Size)
+	}
+	return nil
+}
+
+// resumeUpload uploads size bytes of body as the multipart upload of the
+// checkpoint, starting one when it has none. Every part is read from body,
+// so the parts already on the server are verified against their MD5 and
+// the returned checksums cover the whole object. The checkpoint is removed
+// once the upload completes.
+func resumeUpload(ctx context.Context, cfg config.Config, s3Client *s3.Client, input *s3.PutObjectInput, body io.Reader, cp *Checkpoint, path string) (Result, error) {
+	sums := newChecksums(cfg)
+	tag := etag.NewWriter(max(cp.PartSize, 1))
+	body = io.TeeReader(body, io.MultiWriter(sums, tag))
+	algorithm := checksum.Algorithm(cfg.Checksum)
+	if cp.Size == 0 {
+		in := *input
+		in.Body = body
+		in.ChecksumAlgorithm = algorithm
+		out, err := s3Client.PutObject(ctx, &in)
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{
+			MD5:        sums.Sum(checksum.MD5),
+			Checksums:  sums,
+			ETag:       tag,
+			ServerETag: aws.ToString(out.ETag),
+			Encrypted:  out.ServerSideEncryption == types.ServerSideEncryptionAwsKms,
+		}, nil
+	}
+	uploaded, err := reconcile(ctx, s3Client, cp)
+	if err != nil {
+		return Result{}, err
+	}
+	if cp.UploadID == "" {
+		out, err := s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:            input.Bucket,
+			Key:               input.Key,
+			ContentType:       input.ContentType,
+			Metadata:          input.Metadata,
+			StorageClass:      input.StorageClass,
+			ChecksumAlgorithm: algorithm,
+		})
+		if err != nil {
+			return Result{}, err
+		}
+		cp.UploadID, cp.Parts = aws.ToString(out.UploadId), nil
+		if err = cp.save(path); err != nil {
+			return Result{}, err
+		}
+	}
+	slog.Info("Upload", "upload_id", cp.UploadID, "checkpoint", path)
+	var timer partTimer
+	n, skipped, err := uploadParts(ctx, cfg, s3Client, input, body, cp, path, uploaded, &timer)
+	if err != nil {
+		return Result{Bytes: n}, err
+	}
+	if skipped > 0 {
+		slog.Info("Upload", "result", fmt.Sprintf("resumed, parts already uploaded: %d", skipped))
+	}
+	completed := make([]types.CompletedPart, 0, len(cp.Parts))
+	for _, p := range cp.Parts {
+		part := types.CompletedPart{PartNumber: p.PartNumber, ETag: aws.String(p.ETag)}
+		checksum.CompletedPart(&part, algorithm, p.Checksum)
+		completed = append(completed, part)
+	}
+	out, err := s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          input.Bucket,
+		Key:             input.Key,
+		UploadId:        aws.String(cp.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return Result{Bytes: n}, err
+	}
+	return Result{
+		Bytes:      n,
+		MD5:        sums.Sum(checksum.MD5),
+		Checksums:  sums,
+		Server:     checksum.Values(out.ChecksumCRC32, out.ChecksumCRC32C, out.ChecksumSHA1, out.ChecksumSHA256),
+		ETag:       tag,
+		ServerETag: aws.ToString(out.ETag),
+		Encrypted:  out.ServerSideEncryption == types.ServerSideEncryptionAwsKms,
+		Parts:      timer.sorted(),
+		PartSize:   cp.PartSize,
+	}, os.Remove(path)
+}
+
+// uploadParts reads the parts of the checkpoint from body in order and
+// uploads those the server does not hold yet on cfg.Concurrency workers,
+// saving the checkpoint after every part. It returns the bytes read and
+// the number of parts skipped.
+func uploadParts(ctx context.Context, cfg config.Config, s3Client *s3.Client, input *s3.PutObjectInput, body io.Reader, cp *Checkpoint, path string, uploaded map[int32]multipart.Part, timer *partTimer) (int64, int, error) {
+	algorithm := checksum.Algorithm(cfg.Checksum)
+	workers := max(cfg.Concurrency, 1)
+	// buffers holds a buffer per worker, allocated on first use.
+	buffers := make(chan []byte, workers)
+	for i := 0; i < workers; i++ {
+		buffers <- nil
+	}
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	// stop ends the reading of further parts on the first error, the parts
+	// in flight still finish and are recorded.
+	stop := make(chan struct{})
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			close(stop)
+		}
+	}
+	// record saves the part in the checkpoint, also after a failure of
+	// another part, so that a later run skips it.
+	record := func(part CheckpointPart) {
+		mu.Lock()
+		defer mu.Unlock()
+		cp.setPart(part)
+		if err := cp.save(path); err != nil && firstErr == nil {
+			firstErr = err
+			close(stop)
+		}
+	}
+	var n int64
+	var skipped int
+read:
+	for number := int32(1); n < cp.Size; number++ {
+		var buf []byte
+		select {
+		case buf = <-buffers:
+		case <-stop:
+			break read
+		}
+		if buf == nil {
+			buf = make([]byte, cp.PartSize)
+		}
+		size := min(cp.PartSize, cp.Size-n)
+		if _, err := io.ReadFull(body, buf[:size]); err != nil {
+			fail(fmt.Errorf("part %d: %w", number, err))
+			break
+		}
+		n += size
+		sum := md5.Sum(buf[:size])
+		part := CheckpointPart{PartNumber: number, Size: size, MD5: hex.EncodeToString(sum[:])}
+		if p, ok := uploaded[number]; ok && keepPart(cp.part(number), part, p.ETag) && (algorithm == "" || p.Checksum != "") {
+			part.ETag, part.Checksum = p.ETag, p.Checksum
+			skipped++
+			record(part)
+			buffers <- buf
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { buffers <- buf }()
+			start := time.Now()
+			out, err := s3Client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:            input.Bucket,
+				Key:               input.Key,
+				UploadId:          aws.String(cp.UploadID),
+				PartNumber:        number,
+				Body:              bytes.NewReader(buf[:size]),
+				ContentMD5:        aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+				ChecksumAlgorithm: algorithm,
+			})
+			if err != nil {
+				fail(fmt.Errorf("part %d: %w", number, err))
+				return
+			}
+			part.ETag = aws.ToString(out.ETag)
+			part.Checksum = checksum.Pick(algorithm, out.ChecksumCRC32, out.ChecksumCRC32C, out.ChecksumSHA1, out.ChecksumSHA256)
+			timer.add(PartTiming{PartNumber: number, Size: size, Elapsed: time.Since(start)})
+			record(part)
+		}()
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	return n, skipped, firstErr
+}
+
+// reconcile returns the parts the server has of the upload of the
+// checkpoint, clearing the upload ID when the server no longer knows it.
+func reconcile(ctx context.Context, s3Client *s3.Client, cp *Checkpoint) (map[int32]multipart.Part, error) {
+	uploaded := make(map[int32]multipart.Part)
+	if cp.UploadID == "" {
+		return uploaded, nil
+	}
+	parts, err := multipart.Parts(ctx, s3Client, cp.Bucket, cp.Key, cp.UploadID)
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchUpload" {
+		slog.Warn("Upload no longer exists, starting over", "upload_id", cp.UploadID)
+		cp.UploadID = ""
+		return uploaded, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, p := range parts {
+		uploaded[p.PartNumber] = p
+	}
+	return uploaded, nil
+}
+
+// keepPart reports whether the part on the server with etag holds the data
+// just read. The ETag of a part is its MD5 unless the server encrypts it,
+// then the checkpoint has to vouch for it.
+func keepPart(saved *CheckpointPart, part CheckpointPart, etag string) bool {
+	if strings.Trim(etag, `"`) == part.MD5 {
+		return true
+	}
+	return saved != nil && saved.ETag == etag && saved.MD5 == part.MD5 && saved.Size == part.Size
+}
+
+// openCheckpoint loads the checkpoint of the upload or starts a new one.
+func openCheckpoint(cfg config.Config, bucket, key, source string, size int64) (*Checkpoint, string, error) {
+	path := CheckpointPath(cfg.Checkpoint, bucket, key)
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if cp == nil {
+		ps, err := PartSize(cfg, size)
+		if err != nil {
+			return nil, "", err
+		}
+		return &Checkpoint{Bucket: bucket, Key: key, Size: size, PartSize: ps, Source: source}, path, nil
+	}
+	return cp, path, cp.check(bucket, key, source, size)
+}
@@ -2,200 +2,281 @@ package upload
 
 import (
 	"context"
-	"crypto/md5"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"hash"
 	"io"
 	"log"
 	"log/slog"
 	"math/rand"
-	"net"
-	"net/http"
-	"os"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
+	"github.com/vskurikhin/awsfiles/internal/checksum"
+	"github.com/vskurikhin/awsfiles/internal/client"
 	"github.com/vskurikhin/awsfiles/internal/config"
+	"github.com/vskurikhin/awsfiles/internal/datagen"
+	"github.com/vskurikhin/awsfiles/internal/etag"
+	"github.com/vskurikhin/awsfiles/internal/sizedist"
+	"github.com/vskurikhin/awsfiles/pkg/tool"
 )
 
 const (
 	partMiBs = 5
 )
 
-var zeroTime = new(time.Time)
-
 func Upload(cfg config.Config) {
-	now := time.Now().UnixNano()
-	source := rand.NewSource(now)
-	r := rand.New(source)
-	lr := io.LimitReader(r, int64(cfg.Size))
-	h := md5.New()
-	md5r := md5Reader{h, lr}
+	dist, err := sizedist.Parse(cfg.Size)
+	if err != nil {
+		slog.Error("Upload failed", "err", err)
+		return
+	}
+	gen, err := datagen.Parse(cfg.DataPattern)
+	if err != nil {
+		slog.Error("Upload failed", "err", err)
+		return
+	}
+	count := max(cfg.Count, 1)
+	if count > 1 && cfg.Resume && cfg.Checkpoint != "" {
+		slog.Error("Upload failed", "err", "one --checkpoint file can not resume several objects")
+		return
+	}
 	ctx := context.Background()
-	keys := getKeys(cfg)
-	httpclient := getHTTPClient(cfg)
-	customResolver := getCustomResolver(cfg.S3Host)
-	creeds := credentials.NewStaticCredentialsProvider(keys.AccessKeyID, keys.SecretAccessKey, "")
-	client := s3.NewFromConfig(aws.Config{
-		Credentials:                 creeds,
-		HTTPClient:                  httpclient,
-		EndpointResolverWithOptions: customResolver,
-	})
+	s3Client := client.New(cfg)
 	if cfg.Verbose {
 		slog.Info("Upload", "client", "prepared")
 	}
-	_, err := clientUploaderUpload(ctx, cfg, client, &md5r)
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	sizes := rand.New(rand.NewSource(seed))
+	var total int64
+	for i := 0; i < count; i++ {
+		key := cfg.Key
+		if count > 1 {
+			key = fmt.Sprintf("%s-%d", cfg.Key, i+1)
+		}
+		size := dist.Next(sizes)
+		if cfg.Resume {
+			size = resumedSize(cfg, key, size)
+		}
+		if uploadRandom(ctx, cfg, s3Client, gen, key, size, seed+int64(i)) {
+			total += size
+		}
+	}
+	if count > 1 {
+		slog.Info("Upload", "result", fmt.Sprintf("objects: %d, total write bytes: %d (%s)", count, total, tool.FormatByteSize(total)))
+	}
+}
+
+// resumedSize is the size of the upload of key a checkpoint records, or
+// size when there is none. Without --seed a size drawn from a distribution
+// differs from run to run, the checkpoint keeps the one of its upload.
+func resumedSize(cfg config.Config, key string, size int64) int64 {
+	cp, err := LoadCheckpoint(CheckpointPath(cfg.Checkpoint, cfg.Bucket, key))
+	if err != nil || cp == nil || cp.Bucket != cfg.Bucket || cp.Key != key {
+		return size
+	}
+	return cp.Size
+}
+
+// uploadRandom uploads size bytes gen makes from seed to key, recording
+// the generator and seed in the metadata, and reports whether it did.
+func uploadRandom(ctx context.Context, cfg config.Config, s3Client *s3.Client, gen datagen.Generator, key string, size, seed int64) bool {
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(cfg.Bucket),
+		Key:      aws.String(key),
+		Metadata: datagen.Metadata(gen, seed),
+	}
+	var res Result
+	var err error
+	if cfg.Resume {
+		res, err = resumeRandom(ctx, cfg, s3Client, gen, input, size, seed)
+	} else if input.Body, err = generate(gen, seed, size); err == nil {
+		res, err = PutObject(ctx, cfg, s3Client, input, size)
+	}
 	if err != nil {
-		slog.Error("Upload failed", "err", err)
-		return
+		slog.Error("Upload failed", "key", key, "err", err)
+		return false
 	}
 	err = s3.
-		NewObjectExistsWaiter(client).
+		NewObjectExistsWaiter(s3Client).
 		Wait(
 			ctx,
 			&s3.HeadObjectInput{
 				Bucket: aws.String(cfg.Bucket),
-				Key:    aws.String(cfg.Key),
+				Key:    aws.String(key),
 			}, time.Minute,
 		)
-	slog.Info("Upload", "result", fmt.Sprintf("total write bytes: %d", cfg.Size))
-	value := hex.EncodeToString(md5r.H.Sum(nil))
+	slog.Info("Upload", "result", fmt.Sprintf("s3://%s/%s", cfg.Bucket, key))
+	slog.Info("Upload", "result", fmt.Sprintf("total write bytes: %d", size))
+	slog.Info("Upload", "result", fmt.Sprintf("seed: %s", input.Metadata[datagen.MetaSeed]))
+	value := hex.EncodeToString(res.MD5)
 	slog.Info("Upload", "result", fmt.Sprintf("md5sum: %s", value))
+	LogChecksums(res)
+	LogParts(cfg, res)
+	if err != nil {
+		log.Printf("Failed attempt to wait for object %s to exist.\n", key)
+	}
+	return true
+}
+
+// generate returns size bytes of the data of gen, the same for the same
+// seed.
+func generate(gen datagen.Generator, seed int64, size int64) (io.Reader, error) {
+	r, err := gen.New(seed)
 	if err != nil {
-		log.Printf("Failed attempt to wait for object %s to exist.\n", cfg.Key)
+		return nil, err
 	}
+	return io.LimitReader(r, size), nil
 }
 
-var _ io.Reader = (*md5Reader)(nil)
+// resumeRandom is Upload with a checkpoint, which keeps the seed so that
+// the data of the missing parts is regenerated on restart.
+func resumeRandom(ctx context.Context, cfg config.Config, s3Client *s3.Client, gen datagen.Generator, input *s3.PutObjectInput, size, seed int64) (Result, error) {
+	cp, path, err := openCheckpoint(cfg, cfg.Bucket, aws.ToString(input.Key), gen.ID(), size)
+	if err != nil {
+		return Result{}, err
+	}
+	if cp.Seed == 0 {
+		cp.Seed = seed
+	} else if cfg.Seed != 0 && cp.Seed != seed {
+		return Result{}, fmt.Errorf("checkpoint has seed %d, not %d", cp.Seed, seed)
+	}
+	input.Metadata = datagen.Metadata(gen, cp.Seed)
+	body, err := generate(gen, cp.Seed, size)
+	if err != nil {
+		return Result{}, err
+	}
+	return resumeUpload(ctx, cfg, s3Client, input, body, cp, path)
+}
 
-type md5Reader struct {
-	H hash.Hash
+var _ io.Reader = (*hashReader)(nil)
+
+// hashReader counts and hashes what is read through it.
+type hashReader struct {
+	S *checksum.Set
+	E *etag.Writer
+	N int64     // bytes read so far
 	R io.Reader // underlying reader
 }
 
-func (m *md5Reader) Read(p []byte) (n int, err error) {
-	n, err = m.R.Read(p)
-	m.H.Write(p[:n])
+func (h *hashReader) Read(p []byte) (n int, err error) {
+	n, err = h.R.Read(p)
+	_, _ = h.S.Write(p[:n])
+	_, _ = h.E.Write(p[:n])
+	h.N += int64(n)
 	return n, err
 }
 
-func clientUploaderUpload(ctx context.Context, cfg config.Config, client *s3.Client, reader io.Reader) (*manager.UploadOutput, error) {
-	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
-		u.PartSize = partMiBs * 1024 * 1024
-	})
-	return uploader.Upload(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(cfg.Bucket),
-		Key:    aws.String(cfg.Key),
-		Body:   reader,
-	})
+// Result is what PutObject sent.
+type Result struct {
+	Output    *manager.UploadOutput
+	Bytes     int64
+	MD5       []byte
+	Checksums *checksum.Set
+	// Server holds the additional checksums the server reported.
+	Server map[string]string
+	// ETag is computed locally for PartSize, ServerETag returned.
+	ETag       *etag.Writer
+	ServerETag string
+	// Encrypted is set when the server encrypts with a key of its own,
+	// so the ETag is no MD5.
+	Encrypted bool
+	Parts     []PartTiming
+	PartSize  int64
 }
 
-func getCustomResolver(s3host string) aws.EndpointResolverWithOptionsFunc {
-	return func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-		if region == "" {
-			region = "auto"
-		}
-		if service == s3.ServiceID {
-			return aws.Endpoint{URL: s3host, HostnameImmutable: true, SigningRegion: region}, nil
-		}
-		return aws.Endpoint{}, fmt.Errorf("unknown endpoint requested")
+// PutObject uploads input.Body of size bytes, or -1 when unknown, through
+// manager.Uploader while hashing it with MD5 and the cfg.Checksum
+// checksums, the first S3 supports sent as additional checksum.
+func PutObject(ctx context.Context, cfg config.Config, client *s3.Client, input *s3.PutObjectInput, size int64) (Result, error) {
+	partSize, err := PartSize(cfg, size)
+	if err != nil {
+		return Result{}, err
 	}
-}
-
-func getHTTPClient(cfg config.Config) *http.Client {
-	var tlsCfg *tls.Config
-	if cfg.Ssl() {
-		tlsCfg = createTLSClientConfig(cfg)
-	}
-	transport := &http.Transport{
-		DisableKeepAlives:     false,
-		IdleConnTimeout:       0,
-		TLSHandshakeTimeout:   0,
-		ResponseHeaderTimeout: 0,
-		ExpectContinueTimeout: 0,
-		WriteBufferSize:       cfg.BufferSize,
-		ReadBufferSize:        cfg.BufferSize,
-		TLSClientConfig:       tlsCfg,
-		DialContext:           dialContextFunc(cfg, tlsCfg),
-	}
-	return &http.Client{
-		Transport: transport,
-		Timeout:   0,
+	hr := hashReader{S: newChecksums(cfg), E: etag.NewWriter(partSize), R: input.Body}
+	in := *input
+	in.Body = &hr
+	if in.ChecksumAlgorithm == "" {
+		in.ChecksumAlgorithm = checksum.Algorithm(cfg.Checksum)
+	}
+	var timer partTimer
+	out, err := clientUploaderUpload(ctx, cfg, client, &in, partSize, &timer)
+	var failure manager.MultiUploadFailure
+	if errors.As(err, &failure) && cfg.LeavePartsOnError {
+		slog.Info("Upload", "parts left", failure.UploadID())
 	}
+	res := Result{Output: out, Bytes: hr.N, MD5: hr.S.Sum(checksum.MD5), Checksums: hr.S, ETag: hr.E, Parts: timer.sorted(), PartSize: partSize}
+	if out != nil {
+		res.Server = checksum.Values(out.ChecksumCRC32, out.ChecksumCRC32C, out.ChecksumSHA1, out.ChecksumSHA256)
+		res.ServerETag = aws.ToString(out.ETag)
+		res.Encrypted = out.ServerSideEncryption == types.ServerSideEncryptionAwsKms || in.SSECustomerAlgorithm != nil
+	}
+	return res, err
 }
 
-func createTLSClientConfig(cfg config.Config) *tls.Config {
-	certs := x509.NewCertPool()
+// newChecksums is the set of MD5 and the cfg.Checksum checksums.
+func newChecksums(cfg config.Config) *checksum.Set {
+	return checksum.New(append([]string{checksum.MD5}, cfg.Checksum...)...)
+}
 
-	if cfg.CAFile != "" {
-		pemData, err := os.ReadFile(cfg.CAFile)
-		if err != nil {
-			slog.Error("Read certificate failed", "err", err)
+// LogChecksums reports the checksums but MD5 and the ETag, and whether
+// the server agrees.
+func LogChecksums(res Result) {
+	if res.Checksums == nil {
+		return
+	}
+	logETag(res)
+	for _, name := range res.Checksums.Names() {
+		if name != checksum.MD5 {
+			slog.Info("Upload", "result", fmt.Sprintf("%s: %s", name, res.Checksums.Hex(name)))
 		}
-		certs.AppendCertsFromPEM(pemData)
-	}
-	return &tls.Config{
-		MinVersion: tls.VersionTLS12,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-			tls.TLS_AES_128_GCM_SHA256,
-			tls.TLS_AES_256_GCM_SHA384,
-			tls.TLS_CHACHA20_POLY1305_SHA256,
-		},
-		RootCAs:            certs,
-		InsecureSkipVerify: cfg.InsecureSkipVerify,
-		NextProtos: []string{
-			"http/1.1",
-			"h2",
-		},
+	}
+	matched, skipped, err := checksum.Compare(res.Checksums, res.Server)
+	if err != nil {
+		slog.Error("Checksum failed", "err", err)
+	}
+	for _, name := range matched {
+		slog.Info("Upload", "result", fmt.Sprintf("%s: matches the server", name))
+	}
+	for _, name := range skipped {
+		slog.Info("Upload", "result", fmt.Sprintf("%s: the server has a checksum of the parts", name))
 	}
 }
 
-func dialContextFunc(cfg config.Config, tlsCfg *tls.Config) func(ctx context.Context, network string, addr string) (net.Conn, error) {
-	if cfg.Ssl() {
-		return func(ctx context.Context, network string, addr string) (net.Conn, error) {
-			tlsCfg.ServerName = cfg.ServerName
-			conn, err := tls.Dial("tcp", cfg.Address, tlsCfg)
-			if err != nil {
-				return nil, err
-			}
-			if cfg.Debug {
-				slog.Debug(
-					"connected",
-					"ServerName", conn.ConnectionState().ServerName,
-					"NegotiatedProtocol", conn.ConnectionState().NegotiatedProtocol,
-					"HandshakeComplete", conn.ConnectionState().HandshakeComplete)
-			}
-			err = conn.SetDeadline(*zeroTime)
-			return conn, err
-		}
-	}
-	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
-		conn, err := net.Dial("tcp", cfg.Address)
-		if err != nil {
-			fmt.Println("dial connection failed", "err", err)
-			return nil, err
+func clientUploaderUpload(ctx context.Context, cfg config.Config, client *s3.Client, input *s3.PutObjectInput, partSize int64, timer *partTimer) (*manager.UploadOutput, error) {
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = partSize
+		if cfg.Concurrency > 0 {
+			u.Concurrency = cfg.Concurrency
 		}
-		err = conn.SetDeadline(*zeroTime)
-		return conn, err
-	}
+		u.LeavePartsOnError = cfg.LeavePartsOnError
+		u.ClientOptions = append(u.ClientOptions, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, timer.addMiddleware)
+		})
+	})
+	return uploader.Upload(ctx, input)
 }
 
-func getKeys(cfg config.Config) aws.Credentials {
-	return aws.Credentials{
-		AccessKeyID:     cfg.AccessKeyID,
-		SecretAccessKey: cfg.SecretAccessKey,
+// logETag compares the ETag computed for the part size with the server's,
+// which is no MD5 when the server encrypts with a key of its own.
+func logETag(res Result) {
+	if res.ETag == nil || res.ServerETag == "" {
+		return
+	}
+	local := res.ETag.ETag()
+	switch {
+	case res.Encrypted:
+		slog.Info("Upload", "result", fmt.Sprintf("etag: %s, server %s (encrypted, not compared)", local, res.ServerETag))
+	case res.ETag.Matches(res.ServerETag):
+		slog.Info("Upload", "result", fmt.Sprintf("etag: %s, matches the server", local))
+	default:
+		slog.Error("ETag mismatch", "local", local, "server", etag.Trim(res.ServerETag), "part_size", res.PartSize)
 	}
 }
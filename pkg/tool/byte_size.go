@@ -0,0 +1,100 @@
+package tool
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// byteUnits are the suffixes ParseByteSize accepts, decimal and binary.
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"kib": 1 << 10,
+	"m":   1e6,
+	"mb":  1e6,
+	"mib": 1 << 20,
+	"g":   1e9,
+	"gb":  1e9,
+	"gib": 1 << 30,
+	"t":   1e12,
+	"tb":  1e12,
+	"tib": 1 << 40,
+	"p":   1e15,
+	"pb":  1e15,
+	"pib": 1 << 50,
+}
+
+// ParseByteSize parses a byte count such as 65536, 512KiB, 10GB or 1.5TiB.
+// Units are case-insensitive; KB, MB... are powers of 1000, KiB, MiB...
+// powers of 1024.
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok || i == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	number, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	value := math.Round(number * unit)
+	// float64(math.MaxInt64) is 2^63, which int64 does not hold.
+	if value >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int64(value), nil
+}
+
+// FormatByteSize renders n with the largest binary unit that keeps it at
+// least one and two decimals at most, e.g. 1.5GiB.
+func FormatByteSize(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	value := float64(n)
+	i := 0
+	for ; i < len(units)-1 && math.Abs(value) >= 1024; i++ {
+		value /= 1024
+	}
+	if i == 0 {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	text := strings.TrimRight(strconv.FormatFloat(value, 'f', 2, 64), "0")
+	return strings.TrimSuffix(text, ".") + units[i]
+}
+
+// ByteSize is a pflag.Value of a byte count parsed by ParseByteSize.
+type ByteSize int64
+
+// ByteSizeType is the pflag type name of ByteSize.
+const ByteSizeType = "byteSize"
+
+func NewByteSize(n int64) *ByteSize {
+	b := ByteSize(n)
+	return &b
+}
+
+func (b *ByteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *ByteSize) Set(s string) error {
+	n, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(n)
+	return nil
+}
+
+func (b *ByteSize) Type() string {
+	return ByteSizeType
+}
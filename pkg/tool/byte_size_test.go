@@ -0,0 +1,63 @@
+package tool
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "65536", want: 65536},
+		{in: "10B", want: 10},
+		{in: "1k", want: 1000},
+		{in: "512KiB", want: 512 << 10},
+		{in: "512kib", want: 512 << 10},
+		{in: "10MB", want: 10_000_000},
+		{in: "5MiB", want: 5 << 20},
+		{in: "10GB", want: 10_000_000_000},
+		{in: "1.5TiB", want: 3 << 39},
+		{in: "1PiB", want: 1 << 50},
+		{in: " 2 MiB ", want: 2 << 20},
+		{in: "0.5", want: 1},
+		{in: "", wantErr: true},
+		{in: "MiB", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "10XB", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "9223372036854774784", want: 9223372036854774784},
+		{in: "9000PiB", wantErr: true},
+		{in: "8192PiB", wantErr: true},
+		{in: "9223372036854775807", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseByteSize(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1KiB"},
+		{1536, "1.5KiB"},
+		{5 << 20, "5MiB"},
+		{3 << 29, "1.5GiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatByteSize(tt.in); got != tt.want {
+			t.Errorf("FormatByteSize(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -11,3 +11,11 @@ func SnakeCaseToKebabCase(s string) string {
 	result := strings.ReplaceAll(s, "_", "-")
 	return strings.ToLower(result)
 }
+
+func KebabCaseToEnvVar(prefix, s string) string {
+	result := KebabCaseToSnakeCase(s)
+	if prefix != "" {
+		result = prefix + "_" + result
+	}
+	return strings.ToUpper(result)
+}
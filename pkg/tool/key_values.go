@@ -0,0 +1,22 @@
+package tool
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseKeyValues turns key=value pairs into a map.
+func ParseKeyValues(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
@@ -0,0 +1,18 @@
+package tool
+
+import "strings"
+
+const s3Scheme = "s3://"
+
+func IsS3URI(s string) bool {
+	return strings.HasPrefix(s, s3Scheme)
+}
+
+// ParseS3URI splits s3://bucket/key into the bucket and the key.
+func ParseS3URI(s string) (bucket, key string, ok bool) {
+	if !IsS3URI(s) {
+		return "", "", false
+	}
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(s, s3Scheme), "/")
+	return bucket, key, bucket != ""
+}